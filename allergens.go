@@ -0,0 +1,313 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// allergenKeyword is a word which marks an ingredient as containing an
+// allergen.  The certainty is empty when it does, maybe when it only might,
+// and no when it does not, for an exception like peanut butter to butter.
+type allergenKeyword struct {
+	allergen  string // the key of the allergen
+	name      []string
+	label     string // the keyword as written in the table
+	certainty string
+}
+
+// allergenNames are the allergens in the table as they are written there.
+var allergenNames []string
+
+//go:embed data/allergens.csv
+var allergenData []byte
+
+// allergenTable is parsed from allergenData, longest keywords first so that
+// "soy sauce" is matched before "soy".
+var allergenTable = parseAllergenTable(allergenData)
+
+func parseAllergenTable(data []byte) []allergenKeyword {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	rows, err := r.ReadAll()
+	if err != nil {
+		log.Fatalf("unable to read the allergen table: %v", err)
+	}
+
+	var table []allergenKeyword
+	seen := make(map[string]bool)
+	for _, row := range rows[1:] {
+		key := allergenKey(row[0])
+		if !seen[key] {
+			seen[key] = true
+			allergenNames = append(allergenNames, strings.TrimSpace(row[0]))
+		}
+		table = append(table, allergenKeyword{
+			allergen:  key,
+			name:      words(row[1]),
+			label:     strings.TrimSpace(row[1]),
+			certainty: strings.TrimSpace(row[2])})
+	}
+	sort.SliceStable(table, func(i, j int) bool {
+		return len(table[i].name) > len(table[j].name)
+	})
+	return table
+}
+
+// allergenKey normalises the name of an allergen so that "Nuts" and "nut" are
+// the same.
+func allergenKey(name string) string {
+	return strings.Join(words(name), " ")
+}
+
+// indexWords returns where want first appears as a run of words within have,
+// or -1.
+func indexWords(have, want []string) int {
+	for i := 0; i+len(want) <= len(have); i++ {
+		if strings.Join(have[i:i+len(want)], " ") == strings.Join(want, " ") {
+			return i
+		}
+	}
+	return -1
+}
+
+// A recipe may be tagged to say what it contains, as in "contains nuts", or
+// what it is free of, as in "nut-free".
+var (
+	containsTagWord = stem("contains")
+	freeTagWord     = stem("free")
+)
+
+// allergenTags reports whether the tags say the recipe contains the allergen
+// or is free of it.
+func allergenTags(tags []string, allergen string) (contains, free bool) {
+	for _, tag := range tags {
+		w := words(tag)
+		if len(w) < 2 {
+			continue
+		}
+		if w[0] == containsTagWord && strings.Join(w[1:], " ") == allergen {
+			contains = true
+		}
+		if w[len(w)-1] == freeTagWord && strings.Join(w[:len(w)-1], " ") == allergen {
+			free = true
+		}
+	}
+	return contains, free
+}
+
+// allergenMatches returns the keywords of the allergen found in a line of
+// text, longest first.  The words of each match are hidden from the shorter
+// keywords after it, so that "soy sauce" is not counted again as soy, and an
+// exception hides its words without being returned.
+func allergenMatches(text, allergen string) []allergenKeyword {
+	have := words(text)
+	var found []allergenKeyword
+	for _, kw := range allergenTable {
+		if kw.allergen != allergen {
+			continue
+		}
+		i := indexWords(have, kw.name)
+		if i < 0 {
+			continue
+		}
+		for i >= 0 {
+			for j := range kw.name {
+				have[i+j] = ""
+			}
+			i = indexWords(have, kw.name)
+		}
+		if kw.certainty != "no" {
+			found = append(found, kw)
+		}
+	}
+	return found
+}
+
+// The deepest a recipe's ingredients are followed through links to other
+// recipes.
+const maxAllergenDepth = 5
+
+// checkAllergens looks for the allergens to avoid in a recipe, by its tags and
+// by the words of each ingredient line.  Ingredients which link to another
+// recipe are checked in that recipe.  It returns why the recipe contains an
+// allergen and why it might, for lines which only might or which it cannot
+// check.  A recipe without ingredients cannot be checked, and allergens the
+// prep or instructions mention make it uncertain.
+func checkAllergens(p *Page, avoid []string) (contains, uncertain []string) {
+	return checkAllergensIn(p, avoid, map[string]bool{p.Filename: true}, 0)
+}
+
+func checkAllergensIn(p *Page, avoid []string, seen map[string]bool, depth int) (contains, uncertain []string) {
+	lines := ingredientLines(p.Ingredients)
+
+	for _, allergen := range avoid {
+		taggedContains, taggedFree := allergenTags(p.Tags, allergen)
+		if taggedContains {
+			contains = append(contains, "tagged as containing "+allergen)
+			continue
+		}
+
+		known := false
+		for _, kw := range allergenTable {
+			if kw.allergen == allergen {
+				known = true
+				break
+			}
+		}
+		if !known && !taggedFree {
+			uncertain = append(uncertain, "there is no list of ingredients with "+allergen+" and the recipe is not tagged "+allergen+"-free")
+			continue
+		}
+
+		if len(lines) == 0 {
+			uncertain = append(uncertain, "there are no ingredients to check for "+allergen)
+			continue
+		}
+
+		for _, line := range lines {
+			text := plainText(line)
+			for _, kw := range allergenMatches(text, allergen) {
+				switch {
+				case kw.certainty == "maybe":
+					uncertain = append(uncertain, text+" has "+kw.label+", which may contain "+allergen)
+				case taggedFree:
+					uncertain = append(uncertain, "tagged "+allergen+"-free but "+text+" has "+kw.label)
+				default:
+					contains = append(contains, text+" has "+kw.label)
+				}
+			}
+		}
+
+		// The other sections are only read for what they mention, which
+		// may be an ingredient left out of the list or just advice.
+		others := []struct {
+			mention string
+			lines   []string
+		}{
+			{"the prep mentions ", lineItems(p.Prep)},
+			{"the instructions mention ", strings.Split(string(p.Instructions), "\n")}}
+		mentioned := make(map[string]bool)
+		for _, section := range others {
+			for _, line := range section.lines {
+				text := plainText(listMarker.ReplaceAllString(strings.TrimSpace(line), ""))
+				for _, kw := range allergenMatches(text, allergen) {
+					reason := section.mention + kw.label
+					if !mentioned[reason] {
+						mentioned[reason] = true
+						uncertain = append(uncertain, reason)
+					}
+				}
+			}
+		}
+	}
+
+	// Follow links in the ingredients to the recipes they name.
+	for _, line := range lines {
+		for _, link := range wikiLink.FindAllStringSubmatch(line, -1) {
+			target := resolveLink(convertTitleToFilename(link[1]))
+			if seen[target] {
+				continue
+			}
+			seen[target] = true
+
+			linked, err := loadPage(target)
+			if err != nil || depth >= maxAllergenDepth {
+				uncertain = append(uncertain, link[1]+" could not be checked")
+				continue
+			}
+			c, u := checkAllergensIn(linked, avoid, seen, depth+1)
+			for _, reason := range c {
+				contains = append(contains, link[1]+": "+reason)
+			}
+			for _, reason := range u {
+				uncertain = append(uncertain, link[1]+": "+reason)
+			}
+		}
+	}
+
+	return contains, uncertain
+}
+
+// SafePage lists the recipes without the allergens to avoid.
+type SafePage struct {
+	Title     string
+	Avoid     []string
+	Allergens []string // those the wiki knows the ingredients of
+	Checked   bool
+	Safe      []IndexEntry
+	Uncertain []SafeEntry
+	Excluded  int
+	Theme     string
+	Index     Pages
+}
+
+// SafeEntry is a recipe which might contain an allergen to avoid.
+type SafeEntry struct {
+	IndexEntry
+	Reasons []string
+}
+
+// safeHandler lists the recipes without any of the comma separated
+// allergens in the avoid parameter.  Recipes which might have one of them,
+// or which could not be checked, are listed apart with the reasons, never as
+// safe.  Menus are left out.
+func safeHandler(w http.ResponseWriter, r *http.Request) {
+	sp := &SafePage{
+		Title:     "Recipes Without Allergens",
+		Allergens: allergenNames,
+		Theme:     chooseTheme(w, r),
+		Index:     pages}
+
+	r.ParseForm()
+	seen := make(map[string]bool)
+	for _, value := range r.Form["avoid"] {
+		for _, name := range strings.Split(value, ",") {
+			if key := allergenKey(name); key != "" && !seen[key] {
+				seen[key] = true
+				sp.Avoid = append(sp.Avoid, strings.TrimSpace(name))
+			}
+		}
+	}
+
+	if len(sp.Avoid) > 0 {
+		sp.Checked = true
+		avoid := make([]string, len(sp.Avoid))
+		for i, name := range sp.Avoid {
+			avoid[i] = allergenKey(name)
+		}
+
+		for _, entry := range pages[1:] {
+			if entry.Route != "view" {
+				continue
+			}
+			p, err := loadPage(entry.Filename)
+			if err != nil {
+				sp.Uncertain = append(sp.Uncertain, SafeEntry{entry, []string{"the recipe could not be read"}})
+				continue
+			}
+			contains, uncertain := checkAllergens(p, avoid)
+			switch {
+			case len(contains) > 0:
+				sp.Excluded++
+			case len(uncertain) > 0:
+				sp.Uncertain = append(sp.Uncertain, SafeEntry{entry, uncertain})
+			default:
+				sp.Safe = append(sp.Safe, entry)
+			}
+		}
+	}
+
+	err := templates.ExecuteTemplate(w, "safe.html", sp)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,553 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiIngredient is the JSON form of an ingredient line.  Lines which could
+// not be parsed only have Text set and Parsed false.
+type apiIngredient struct {
+	Quantity float64 `json:"quantity,omitempty"`
+	Max      float64 `json:"quantity_max,omitempty"` // the high end of a range
+	Amount   string  `json:"amount,omitempty"`       // the quantity written out
+	Unit     string  `json:"unit,omitempty"`
+	Item     string  `json:"item,omitempty"`
+	Text     string  `json:"text,omitempty"`
+	Parsed   bool    `json:"parsed"`
+}
+
+// apiKey, when set, must be sent in the X-API-Key header of requests to the
+// API endpoints which change pages.
+var apiKey string
+
+// requireAPIKey wraps an API handler which writes pages so that it responds
+// 401 Unauthorized unless the request carries the configured key.
+func requireAPIKey(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiKey != "" {
+			key := r.Header.Get("X-API-Key")
+			if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) != 1 {
+				writeJSONError(w, "a valid X-API-Key is required", http.StatusUnauthorized)
+				return
+			}
+		}
+		fn(w, r)
+	}
+}
+
+// corsOrigins are the other origins allowed to call the API from a browser.
+// "*" allows any.  With none the browser keeps the API same-origin only.
+var corsOrigins []string
+
+// setCORSOrigins sets corsOrigins from a comma separated list.
+func setCORSOrigins(list string) error {
+	corsOrigins = nil
+	for _, origin := range strings.Split(list, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			corsOrigins = append(corsOrigins, origin)
+		}
+	}
+	return nil
+}
+
+// allowedOrigin reports whether a browser on origin may call the API.
+func allowedOrigin(origin string) bool {
+	for _, allowed := range corsOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// allowCORS wraps an API handler with the headers that let the browser call
+// it from an allowed origin, and answers the browser's preflight requests.
+func allowCORS(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !allowedOrigin(origin) {
+			fn(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+
+		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		fn(w, r)
+	}
+}
+
+// writeJSON writes v to the response as JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// apiError is the JSON body of every failed API request.  Code repeats the
+// HTTP status.
+type apiError struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
+// writeJSONError is the API's version of http.Error.
+func writeJSONError(w http.ResponseWriter, message string, status int) {
+	writeJSON(w, status, apiError{Error: message, Code: status})
+}
+
+// makeAPIHandler is makeHandler for the API, which reports a bad path as a
+// JSON error.
+func makeAPIHandler(fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := validPath.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			writeJSONError(w, "no such recipe", http.StatusNotFound)
+			return
+		}
+		fn(w, r, m[2])
+	}
+}
+
+// apiRecipeHandler returns a recipe as JSON.  It is what /view/ gives clients
+// which ask for JSON, and is also served as /api/recipe/.
+func apiRecipeHandler(w http.ResponseWriter, r *http.Request, title string) {
+	p, err := loadPage(title)
+	if os.IsNotExist(err) {
+		writeJSONError(w, "no such recipe", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIRecipe(p))
+}
+
+// jsonOnly serves fn as if the client had asked for JSON, for the routes of
+// a listener which has no html pages to send instead.
+func jsonOnly(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = r.Clone(r.Context())
+		r.Header.Set("Accept", "application/json")
+		fn(w, r)
+	}
+}
+
+// apiScaledHandler returns a recipe's ingredients scaled from its stored
+// servings to the number requested in the servings parameter.  The amounts
+// are written as fractions unless frac=0, or -quantities, asks for decimals.
+func apiScaledHandler(w http.ResponseWriter, r *http.Request, title string) {
+	p, err := loadPage(title)
+	if err != nil {
+		writeJSONError(w, "no such recipe", http.StatusNotFound)
+		return
+	}
+
+	servings, err := strconv.ParseFloat(r.FormValue("servings"), 64)
+	if err != nil || servings <= 0 {
+		writeJSONError(w, "servings must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	base, ok := parseServings(p.Servings)
+	if !ok {
+		writeJSONError(w, "the recipe does not say how many it serves", http.StatusBadRequest)
+		return
+	}
+
+	scaled := scaleIngredients(ingredientLines(p.Ingredients), servings/base)
+	format := quantityFormatter(chooseQuantityStyle(r))
+	writeJSON(w, http.StatusOK, apiIngredients(scaled, format))
+}
+
+// apiIngredients converts ingredients to their JSON form, writing their
+// amounts with format.
+func apiIngredients(scaled []ScaledIngredient, format func(float64) string) []apiIngredient {
+	result := make([]apiIngredient, 0, len(scaled))
+	for _, in := range scaled {
+		if !in.Parsed {
+			result = append(result, apiIngredient{Text: in.Line})
+			continue
+		}
+		result = append(result, apiIngredient{
+			Quantity: in.Quantity,
+			Max:      in.Max,
+			Amount:   in.formatAmount(format),
+			Unit:     in.Unit,
+			Item:     in.Item,
+			Parsed:   true})
+	}
+	return result
+}
+
+// apiRecipe is the JSON form of a recipe.  The ingredients are given both
+// parsed and as the markdown they were written in.
+type apiRecipe struct {
+	Title          string          `json:"title"`
+	Filename       string          `json:"filename"`
+	ID             string          `json:"id,omitempty"`
+	Category       string          `json:"category,omitempty"`
+	Servings       string          `json:"servings,omitempty"`
+	Video          string          `json:"video,omitempty"`
+	Source         string          `json:"source,omitempty"`
+	Tags           []string        `json:"tags"`
+	Flags          []string        `json:"flags"`
+	Ingredients    []apiIngredient `json:"ingredients"`
+	RawIngredients string          `json:"ingredients_markdown"`
+	Instructions   string          `json:"instructions"`
+	Prep           []string        `json:"prep"`
+	Equipment      []string        `json:"equipment"`
+	Collection     string          `json:"collection,omitempty"`
+	ForkedFrom     string          `json:"forked_from,omitempty"`
+	MakeAgain      string          `json:"make_again,omitempty"`
+	MadeCount      int             `json:"made_count"`
+	LastCooked     string          `json:"last_cooked,omitempty"`
+	Author         string          `json:"author,omitempty"`
+	LastEditedBy   string          `json:"last_edited_by,omitempty"`
+	Photo          string          `json:"photo,omitempty"`
+}
+
+// newAPIRecipe describes a page as it was loaded, before it is rendered.
+func newAPIRecipe(p *Page) apiRecipe {
+	recipe := apiRecipe{
+		Title:          p.Title,
+		Filename:       p.Filename,
+		ID:             p.ID,
+		Category:       p.Category,
+		Servings:       p.Servings,
+		Video:          p.Video,
+		Source:         p.Source,
+		Tags:           p.Tags,
+		Flags:          p.Flags,
+		Ingredients:    apiIngredients(scaleIngredients(ingredientLines(p.Ingredients), 1), formatQuantity),
+		RawIngredients: string(p.Ingredients),
+		Instructions:   string(p.Instructions),
+		Prep:           lineItems(p.Prep),
+		Equipment:      lineItems(p.Equipment),
+		Collection:     string(p.Collection),
+		ForkedFrom:     p.ForkedFrom,
+		MakeAgain:      p.MakeAgain,
+		MadeCount:      p.MadeCount,
+		LastCooked:     p.LastCooked,
+		Author:         p.Author,
+		LastEditedBy:   p.LastEditedBy}
+	if photo := photoURL(p.Filename); photo != "" {
+		recipe.Photo = basePath + photo
+	}
+	if recipe.Tags == nil {
+		recipe.Tags = []string{}
+	}
+	if recipe.Flags == nil {
+		recipe.Flags = []string{}
+	}
+	if recipe.Prep == nil {
+		recipe.Prep = []string{}
+	}
+	if recipe.Equipment == nil {
+		recipe.Equipment = []string{}
+	}
+	return recipe
+}
+
+// wantsJSON reports whether the Accept header prefers JSON to HTML.  Without
+// a preference for JSON the answer is HTML, which is what browsers get.
+func wantsJSON(r *http.Request) bool {
+	var jsonQ, htmlQ float64
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			q = v
+		}
+		switch mediaType {
+		case "application/json":
+			jsonQ = math.Max(jsonQ, q)
+		case "text/html":
+			htmlQ = math.Max(htmlQ, q)
+		}
+	}
+	return jsonQ > htmlQ
+}
+
+// apiSaveRequest is the JSON body accepted by apiSaveHandler.  Fields which
+// are left out keep their stored values.
+type apiSaveRequest struct {
+	Title        *string  `json:"title"`
+	Ingredients  *string  `json:"ingredients"`
+	Instructions *string  `json:"instructions"`
+	Prep         *string  `json:"prep"`
+	Equipment    *string  `json:"equipment"`
+	Servings     *string  `json:"servings"`
+	Video        *string  `json:"video"`
+	Source       *string  `json:"source"`
+	Tags         []string `json:"tags"`
+	Flags        []string `json:"flags"`
+	Collection   *string  `json:"collection"`
+	Category     *string  `json:"category"`
+}
+
+// apply copies the fields which were sent onto the page.
+func (req *apiSaveRequest) apply(p *Page) {
+	if req.Title != nil {
+		p.Title = *req.Title
+	}
+	if req.Ingredients != nil {
+		p.Ingredients = template.HTML(*req.Ingredients)
+	}
+	if req.Instructions != nil {
+		p.Instructions = template.HTML(*req.Instructions)
+	}
+	if req.Prep != nil {
+		p.Prep = strings.TrimSpace(*req.Prep)
+	}
+	if req.Equipment != nil {
+		p.Equipment = strings.TrimSpace(*req.Equipment)
+	}
+	if req.Servings != nil {
+		p.Servings = strings.TrimSpace(*req.Servings)
+	}
+	if req.Video != nil {
+		p.Video = strings.TrimSpace(*req.Video)
+	}
+	if req.Source != nil {
+		p.Source = strings.TrimSpace(*req.Source)
+	}
+	if req.Tags != nil {
+		p.Tags = parseTags(strings.Join(req.Tags, ","))
+	}
+	if req.Flags != nil {
+		p.Flags = parseTags(strings.Join(req.Flags, ","))
+	}
+	if req.Collection != nil {
+		p.Collection = template.HTML(*req.Collection)
+	}
+	if req.Category != nil && categoryDirs {
+		p.Category = *req.Category
+	}
+}
+
+// apiSaveHandler saves a recipe from a JSON body the way saveHandler does and
+// responds with the filename and view URL it was saved under, so the edit
+// page can save without leaving the page.
+func apiSaveHandler(w http.ResponseWriter, r *http.Request, title string) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req apiSaveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p, err := loadPage(title)
+	if err != nil && !os.IsNotExist(err) {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		p = &Page{Title: convertFilenameToTitle(title)}
+		p.Category, _ = splitCategory(title)
+	}
+	req.apply(p)
+	credit(p, editorName(r))
+
+	err = savePage(p, title)
+	if err == errNoTitle || err == errSectionMarker || err == errBadVideo {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == errTooManyRecipes {
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"filename": p.Filename,
+		"url":      basePath + "/view/" + p.Filename})
+}
+
+// Reorder requests look like /api/reorder/<filename>/<section>.
+var reorderPath = regexp.MustCompile("^/api/reorder/(" + filenamePattern + ")/(ingredients|instructions)$")
+
+// apiReorderHandler puts the lines of a recipe's ingredients or instructions
+// in a new order, from a JSON array of the lines, leaving the rest of the
+// recipe as it is stored now.  The array must hold exactly the section's
+// current lines.
+func apiReorderHandler(w http.ResponseWriter, r *http.Request) {
+	m := reorderPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		writeJSONError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var lines []string
+	if err := json.NewDecoder(r.Body).Decode(&lines); err != nil {
+		writeJSONError(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := reorderSection(m[1], m[2], lines, editorName(r))
+	if os.IsNotExist(err) {
+		writeJSONError(w, "no such recipe", http.StatusNotFound)
+		return
+	}
+	if err == errNotReordered || err == errSectionMarker {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"filename": m[1],
+		"url":      basePath + "/view/" + m[1]})
+}
+
+// reindexHandler rebuilds the index from the stored pages, to pick up files
+// changed outside the wiki, and responds with the number of recipes.
+func reindexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := updateIndex(); err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"recipes": len(pages) - 1})
+}
+
+// Markdown which is removed from plain text output.
+var markdownLink = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+var markdownEmphasis = regexp.MustCompile("[*_`]+")
+
+// plainText strips the markdown from a single line, leaving link text in
+// place of links.
+func plainText(line string) string {
+	line = wikiLink.ReplaceAllString(line, "$1")
+	line = markdownLink.ReplaceAllString(line, "$1")
+	line = markdownEmphasis.ReplaceAllString(line, "")
+	return strings.TrimSpace(line)
+}
+
+// textIngredientsHandler returns a recipe's ingredients as plain text, one per
+// line.  Headings within the ingredients are left out.
+func textIngredientsHandler(w http.ResponseWriter, r *http.Request, title string) {
+	p, err := loadPage(title)
+	if err != nil {
+		notFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range ingredientLines(p.Ingredients) {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if text := plainText(line); text != "" {
+			fmt.Fprintln(w, text)
+		}
+	}
+}
+
+// History requests look like /api/history/<filename> for the list of a
+// page's snapshots or /api/history/<filename>/<timestamp> for one of them.
+var apiHistoryPath = regexp.MustCompile(`^/api/history/(` + filenamePattern + `)(?:/(\d{8}T\d{6}\.\d{9}Z))?$`)
+
+// apiSnapshot describes one snapshot of a page.
+type apiSnapshot struct {
+	Timestamp string    `json:"timestamp"`
+	Time      time.Time `json:"time"`
+	Content   string    `json:"content,omitempty"`
+}
+
+// apiHistoryHandler lists the snapshots kept of a page, or returns the raw
+// content of one of them, so that other tools can show and restore old
+// versions.
+func apiHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	m := apiHistoryPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		writeJSONError(w, "no such page", http.StatusNotFound)
+		return
+	}
+	filename, stamp := m[1], m[2]
+
+	if stamp != "" {
+		body, err := loadSnapshot(filename, stamp)
+		if os.IsNotExist(err) {
+			writeJSONError(w, "no such snapshot", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		t, _ := time.Parse(snapshotLayout, stamp)
+		writeJSON(w, http.StatusOK, apiSnapshot{Timestamp: stamp, Time: t, Content: string(body)})
+		return
+	}
+
+	stamps, err := listSnapshots(filename)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// A page which was deleted may still have snapshots.
+	if len(stamps) == 0 {
+		if _, err := store.Load(filename); err != nil {
+			writeJSONError(w, "no such page", http.StatusNotFound)
+			return
+		}
+	}
+
+	snapshots := make([]apiSnapshot, 0, len(stamps))
+	for _, stamp := range stamps {
+		t, _ := time.Parse(snapshotLayout, stamp)
+		snapshots = append(snapshots, apiSnapshot{Timestamp: stamp, Time: t})
+	}
+	writeJSON(w, http.StatusOK, snapshots)
+}
@@ -0,0 +1,85 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// defaultAuthor is credited with changes made by someone who did not sign in.
+var defaultAuthor string
+
+// authorEmails maps the names of authors to their email addresses, which are
+// only used to show their gravatars.  It is empty unless -author-emails is
+// given.
+var authorEmails map[string]string
+
+// trustBasicAuth is whether the user name of HTTP basic auth may be believed.
+// The wiki does not check the password itself, so this is only safe behind a
+// proxy which authenticates every request.  It is set by -trust-basic-auth.
+var trustBasicAuth bool
+
+// editorName returns who is making a request: the user name of HTTP basic
+// auth when it is trusted, or else defaultAuthor.
+func editorName(r *http.Request) string {
+	if !trustBasicAuth {
+		return defaultAuthor
+	}
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return user
+	}
+	return defaultAuthor
+}
+
+// credit records editor as having changed the page, and as its author when
+// it has none yet.
+func credit(p *Page, editor string) {
+	if p.Author == "" {
+		p.Author = editor
+	}
+	p.LastEditedBy = editor
+}
+
+// loadAuthorEmails reads the email addresses of authors from a CSV file with
+// a name and an address on each line.  Lines starting with # are ignored.
+func loadAuthorEmails(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 2
+	rows, err := r.ReadAll()
+	if err != nil {
+		return fmt.Errorf("unable to read the author emails: %v", err)
+	}
+
+	emails := make(map[string]string)
+	for _, row := range rows {
+		emails[strings.TrimSpace(row[0])] = strings.TrimSpace(row[1])
+	}
+	authorEmails = emails
+	return nil
+}
+
+// avatarURL returns the address of the gravatar of the named author, or "" when
+// there is no email address for them.
+func avatarURL(name string) string {
+	email, ok := authorEmails[name]
+	if !ok || email == "" {
+		return ""
+	}
+	sum := md5.Sum([]byte(strings.ToLower(email)))
+	return "https://www.gravatar.com/avatar/" + hex.EncodeToString(sum[:]) + "?s=40&d=identicon"
+}
@@ -0,0 +1,42 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEditorName(t *testing.T) {
+	defer func(trust bool, author string) {
+		trustBasicAuth, defaultAuthor = trust, author
+	}(trustBasicAuth, defaultAuthor)
+	defaultAuthor = "cook"
+
+	signedIn := httptest.NewRequest("POST", "/save/Toast", nil)
+	signedIn.SetBasicAuth("ann", "anything")
+	anonymous := httptest.NewRequest("POST", "/save/Toast", nil)
+
+	tests := []struct {
+		trust bool
+		req   string
+		want  string
+	}{
+		{false, "signed in", "cook"},
+		{false, "anonymous", "cook"},
+		{true, "signed in", "ann"},
+		{true, "anonymous", "cook"},
+	}
+	for _, tt := range tests {
+		trustBasicAuth = tt.trust
+		r := anonymous
+		if tt.req == "signed in" {
+			r = signedIn
+		}
+		if got := editorName(r); got != tt.want {
+			t.Errorf("editorName(%s) with trust %v = %q, want %q", tt.req, tt.trust, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// When autolink is set, the first mention of another recipe's exact title in
+// a recipe's instructions becomes a link to it.
+var autolink bool
+
+// autolinkTarget is a recipe title, escaped as it appears in rendered html,
+// and the URL it links to.
+type autolinkTarget struct {
+	text string
+	href string
+}
+
+// autolinks holds a target for every recipe in the index, longest title first
+// so that "Apple Pie Crust" is linked rather than "Apple Pie".  Scanning for
+// every title costs time on each render, so the list is built once whenever
+// the index is updated instead of on each page view.
+var autolinks []autolinkTarget
+
+func buildAutolinks(index Pages) []autolinkTarget {
+	var targets []autolinkTarget
+	for _, entry := range index {
+		if entry.Filename == rootTitle || strings.TrimSpace(entry.Title) == "" {
+			continue
+		}
+		targets = append(targets, autolinkTarget{
+			text: html.EscapeString(entry.Title),
+			href: basePath + "/" + entry.Route + "/" + entry.Filename})
+	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		return len(targets[i].text) > len(targets[j].text)
+	})
+	return targets
+}
+
+// An html tag, and the tags whose contents must not be linked.
+var htmlTag = regexp.MustCompile(`<(/?)([a-zA-Z0-9]*)[^>]*>`)
+var noLinkTags = map[string]bool{"a": true, "code": true, "pre": true}
+
+// autolinkTitles links the first mention of each recipe title in rendered
+// html, other than the title self.
+func autolinkTitles(text []byte, self string) []byte {
+	linked := map[string]bool{html.EscapeString(self): true}
+	return mapText(text, func(run []byte) []byte {
+		return linkTitles(run, linked)
+	})
+}
+
+// mapText applies fn to each run of text between the tags of rendered html,
+// in order, and leaves alone the text inside links, code spans and code
+// blocks.
+func mapText(text []byte, fn func(run []byte) []byte) []byte {
+	var out bytes.Buffer
+	depth := 0
+
+	last := 0
+	for _, m := range htmlTag.FindAllSubmatchIndex(text, -1) {
+		if depth == 0 {
+			out.Write(fn(text[last:m[0]]))
+		} else {
+			out.Write(text[last:m[0]])
+		}
+		out.Write(text[m[0]:m[1]])
+		last = m[1]
+
+		if name := strings.ToLower(string(text[m[4]:m[5]])); noLinkTags[name] {
+			if m[3] > m[2] {
+				depth--
+			} else {
+				depth++
+			}
+		}
+	}
+	if depth == 0 {
+		out.Write(fn(text[last:]))
+	} else {
+		out.Write(text[last:])
+	}
+
+	return out.Bytes()
+}
+
+// linkTitles links the first whole-word mention of each title in a run of
+// text which has not been linked already.
+func linkTitles(text []byte, linked map[string]bool) []byte {
+	type span struct {
+		start, end int
+		href       string
+	}
+	var spans []span
+
+	for _, t := range autolinks {
+		if linked[t.text] {
+			continue
+		}
+
+	search:
+		for from := 0; ; {
+			i := bytes.Index(text[from:], []byte(t.text))
+			if i < 0 {
+				break
+			}
+			start, end := from+i, from+i+len(t.text)
+			from = start + 1
+
+			if !wordBoundary(text, start, end) {
+				continue
+			}
+			for _, s := range spans {
+				if start < s.end && s.start < end {
+					continue search
+				}
+			}
+
+			spans = append(spans, span{start, end, t.href})
+			linked[t.text] = true
+			break
+		}
+	}
+
+	if len(spans) == 0 {
+		return text
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var out bytes.Buffer
+	last := 0
+	for _, s := range spans {
+		out.Write(text[last:s.start])
+		out.WriteString(`<a href="` + s.href + `">`)
+		out.Write(text[s.start:s.end])
+		out.WriteString("</a>")
+		last = s.end
+	}
+	out.Write(text[last:])
+	return out.Bytes()
+}
+
+// wordBoundary reports whether text[start:end] is not part of a longer word.
+func wordBoundary(text []byte, start, end int) bool {
+	if r, _ := utf8.DecodeLastRune(text[:start]); start > 0 && isWordRune(r) {
+		return false
+	}
+	if r, _ := utf8.DecodeRune(text[end:]); end < len(text) && isWordRune(r) {
+		return false
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,144 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// autotagRule proposes a tag for recipes whose ingredients mention every one
+// of its keywords.
+type autotagRule struct {
+	tag      string
+	keywords [][]string // the stemmed words of each keyword
+}
+
+//go:embed data/autotags.csv
+var autotagData []byte
+
+// autotagRules is parsed from autotagData.
+var autotagRules = parseAutotagRules(autotagData)
+
+func parseAutotagRules(data []byte) []autotagRule {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	rows, err := r.ReadAll()
+	if err != nil {
+		log.Fatalf("unable to read the autotag table: %v", err)
+	}
+
+	var rules []autotagRule
+	for _, row := range rows[1:] {
+		rule := autotagRule{tag: strings.TrimSpace(row[0])}
+		for _, keyword := range strings.Split(row[1], "+") {
+			rule.keywords = append(rule.keywords, words(keyword))
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// proposeTags returns the tags the autotag rules give a recipe which it does
+// not already have, in the order of the table.
+func proposeTags(p *Page) []string {
+	var lines [][]string
+	for _, line := range ingredientLines(p.Ingredients) {
+		lines = append(lines, words(plainText(line)))
+	}
+	mentions := func(keyword []string) bool {
+		for _, line := range lines {
+			if indexWords(line, keyword) >= 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	have := make(map[string]bool)
+	for _, tag := range p.Tags {
+		have[strings.ToLower(tag)] = true
+	}
+
+	var tags []string
+	for _, rule := range autotagRules {
+		if have[strings.ToLower(rule.tag)] {
+			continue
+		}
+		matched := true
+		for _, keyword := range rule.keywords {
+			if !mentions(keyword) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			have[strings.ToLower(rule.tag)] = true
+			tags = append(tags, rule.tag)
+		}
+	}
+	return tags
+}
+
+// AutotagPage reports the tags proposed for, or added to, each recipe.
+type AutotagPage struct {
+	Title   string
+	DryRun  bool
+	Changes []AutotagChange
+	Theme   string
+}
+
+// AutotagChange is the tags added to one recipe.
+type AutotagChange struct {
+	Title    string
+	Filename string
+	Tags     []string
+}
+
+// autotagHandler tags every recipe from the words of its ingredients, adding
+// to the tags it has and never removing any.  Unless the request is a POST
+// without the dryrun parameter it only reports the tags it would add.
+func autotagHandler(w http.ResponseWriter, r *http.Request) {
+	at := &AutotagPage{
+		Title:  "Tag Recipes from Their Ingredients",
+		DryRun: r.Method != "POST" || r.FormValue("dryrun") != "",
+		Theme:  chooseTheme(w, r)}
+
+	for _, entry := range pages[1:] {
+		p, err := loadPage(entry.Filename)
+		if err != nil || p.Collection != "" {
+			continue
+		}
+		tags := proposeTags(p)
+		if len(tags) == 0 {
+			continue
+		}
+
+		if !at.DryRun {
+			// The recipe is read again in case it changed since.
+			err := updatePage(p.Filename, func(p *Page) error {
+				p.Tags = mergeTags(p.Tags, tags)
+				return nil
+			})
+			if err != nil {
+				serverError(w, r, err)
+				return
+			}
+		}
+		at.Changes = append(at.Changes, AutotagChange{
+			Title:    p.Title,
+			Filename: p.Filename,
+			Tags:     tags})
+	}
+
+	err := templates.ExecuteTemplate(w, "autotag.html", at)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// canonicalHost, when set, is the host, with any port, which the wiki is
+// served under.  Requests for any other host, such as the server's address,
+// are redirected to it so that every link and bookmark uses the one name.
+var canonicalHost string
+
+// setCanonicalHost sets canonicalHost from the -canonical-host flag.
+func setCanonicalHost(host string) error {
+	if host == "" || strings.ContainsAny(host, "/?#@ ") {
+		return fmt.Errorf("%q is not a host name", host)
+	}
+	canonicalHost = strings.ToLower(host)
+	return nil
+}
+
+// redirectToCanonicalHost wraps the wiki's handler so that requests for a
+// host other than canonicalHost are permanently redirected to the same path
+// on it.  It does nothing when no canonical host is set.
+func redirectToCanonicalHost(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if canonicalHost == "" || strings.EqualFold(r.Host, canonicalHost) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		// Browsers turn a POST into a GET on a 301, so anything other than a
+		// GET gets a 308, which keeps the method and body.
+		code := http.StatusMovedPermanently
+		if r.Method != "GET" && r.Method != "HEAD" {
+			code = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, scheme+"://"+canonicalHost+r.URL.RequestURI(), code)
+	})
+}
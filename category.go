@@ -0,0 +1,58 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// When categoryDirs is set the edit page asks for a category and each recipe
+// is stored in a subdirectory of pagesDir named for it.  A recipe's filename
+// then includes its category, like Desserts/Apple-Pie, and so do its URLs.
+// Pages already stored flat, or in a subdirectory, stay where they are either
+// way.
+var categoryDirs bool
+
+// splitCategory separates the category, if any, from a filename.
+func splitCategory(filename string) (category, name string) {
+	if i := strings.LastIndex(filename, "/"); i >= 0 {
+		return filename[:i], filename[i+1:]
+	}
+	return "", filename
+}
+
+// joinCategory makes the filename for a page named name in category.
+func joinCategory(category, name string) string {
+	category = convertTitleToFilename(category)
+	if category == "" {
+		return name
+	}
+	return path.Join(category, name)
+}
+
+// resolveLink finds the page a [[Name]] link points to.  Links name pages
+// without their category so the index is searched for a page stored under
+// one.  A page whose filename was made before titles were converted the way
+// they are now is found by its title.  The target is returned unchanged when
+// no page matches.
+func resolveLink(target string) string {
+	for _, entry := range pages {
+		if entry.Filename == target {
+			return target
+		}
+	}
+	for _, entry := range pages {
+		if _, name := splitCategory(entry.Filename); name == target {
+			return entry.Filename
+		}
+	}
+	for _, entry := range pages {
+		if convertTitleToFilename(entry.Title) == target {
+			return entry.Filename
+		}
+	}
+	return target
+}
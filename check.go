@@ -0,0 +1,39 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// checkPages parses every stored page and reports each one which is
+// malformed to out.  It returns the number of malformed pages.
+func checkPages(out io.Writer) (int, error) {
+	names, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	bad := 0
+	for _, name := range names {
+		// The home page is plain markdown without sections.
+		if name == rootTitle {
+			continue
+		}
+
+		body, err := store.Load(name)
+		if err == nil {
+			_, err = parseRecipe(body)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "%s: %v\n", name, err)
+			bad++
+		}
+	}
+
+	fmt.Fprintf(out, "checked %d pages, %d malformed\n", len(names), bad)
+	return bad, nil
+}
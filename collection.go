@@ -0,0 +1,98 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MenuPage is a collection page, such as a menu, along with the recipes it
+// lists and their combined ingredients.
+type MenuPage struct {
+	Title       string
+	Filename    string
+	Recipes     []*Page
+	Missing     []string
+	Servings    string   // the servings the recipes are scaled to as a decimal, if any
+	Unscaled    []string // recipes which do not say how many they serve
+	Ingredients []string
+	Theme       string
+	Index       Pages
+}
+
+// loadMenu reads a collection page and each of the recipes it links to.
+// Links to recipes which do not exist are reported in Missing.  When servings
+// is more than zero each recipe's ingredients are scaled to make that many
+// servings.  Recipes which do not say how many they serve are left as they
+// are and reported in Unscaled.
+func loadMenu(file string, servings float64) (*MenuPage, error) {
+	p, err := loadPage(file)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MenuPage{
+		Title:    p.Title,
+		Filename: p.Filename,
+		Index:    pages.Viewing(file)}
+
+	for _, link := range wikiLink.FindAllStringSubmatch(string(p.Collection), -1) {
+		recipe, err := loadPage(resolveLink(convertTitleToFilename(link[1])))
+		if err != nil {
+			m.Missing = append(m.Missing, link[1])
+			continue
+		}
+		m.Recipes = append(m.Recipes, recipe)
+	}
+
+	if servings > 0 {
+		m.Servings = strconv.FormatFloat(servings, 'f', -1, 64)
+		for _, recipe := range m.Recipes {
+			base, ok := parseServings(recipe.Servings)
+			if !ok {
+				m.Unscaled = append(m.Unscaled, recipe.Title)
+				continue
+			}
+			var lines []string
+			for _, in := range scaleIngredients(ingredientLines(recipe.Ingredients), servings/base) {
+				lines = append(lines, in.text(formatQuantity))
+			}
+			recipe.Ingredients = template.HTML(strings.Join(lines, "\n"))
+		}
+	}
+	m.Ingredients = mergeIngredients(m.Recipes)
+
+	return m, nil
+}
+
+// menuHandler renders a collection with a combined list of the ingredients
+// needed for every recipe in it, scaled to the number in the servings
+// parameter when there is one.
+func menuHandler(w http.ResponseWriter, r *http.Request, title string) {
+	var servings float64
+	if s := strings.TrimSpace(r.FormValue("servings")); s != "" {
+		var ok bool
+		if servings, ok = parseServings(s); !ok {
+			http.Error(w, "servings must be a positive number.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	m, err := loadMenu(title, servings)
+	if err != nil {
+		notFound(w, r)
+		return
+	}
+
+	m.Theme = chooseTheme(w, r)
+
+	err = templates.ExecuteTemplate(w, "menu.html", m)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMenuServingsField(t *testing.T) {
+	s := useMemStore(t)
+	s.Save("Apple-Pie", []byte("<!-- Title -->\nApple Pie\n<!-- Ingredients -->\n- 6 apples\n<!-- Instructions -->\nBake.\n<!-- Servings -->\n8\n"))
+	s.Save("Dinner", []byte("<!-- Title -->\nDinner\n<!-- Collection -->\n[[Apple Pie]]\n"))
+	refreshIndex()
+
+	w := serve(makeHandler(menuHandler), "GET", "/menu/Dinner?servings=2.5", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /menu/Dinner?servings=2.5 = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), `step="any" value="2.5"`) {
+		t.Errorf("the servings field does not hold 2.5:\n%s", w.Body.String())
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/url"
+	"strings"
+)
+
+// IngredientRow is one row of the ingredients shown as a table, with the
+// amount in a column of its own.  Rows without an Amount span both columns.
+type IngredientRow struct {
+	Amount  string
+	Item    template.HTML
+	Heading bool
+}
+
+// ingredientRows splits each ingredient line into its amount, with the unit,
+// and the rest of the line.  Lines which do not start with a quantity are
+// kept whole, and headings within the ingredients are marked as such.
+func ingredientRows(ingredients template.HTML) []IngredientRow {
+	var rows []IngredientRow
+	for _, line := range ingredientLines(ingredients) {
+		if strings.HasPrefix(line, "#") {
+			rows = append(rows, IngredientRow{
+				Item:    renderInline(strings.TrimLeft(line, "# ")),
+				Heading: true})
+			continue
+		}
+
+		in, ok := parseIngredient(line)
+		if !ok {
+			rows = append(rows, IngredientRow{Item: renderInline(line)})
+			continue
+		}
+		amount := in.Amount
+		if in.UnitText != "" {
+			amount += " " + in.UnitText
+		}
+		rows = append(rows, IngredientRow{Amount: amount, Item: renderInline(in.Item)})
+	}
+	return rows
+}
+
+// renderInline renders a single line of markdown and its wiki links without
+// wrapping it in a paragraph.
+func renderInline(line string) template.HTML {
+	html := bytes.TrimSpace(renderer.Render([]byte(line)))
+	html = bytes.TrimPrefix(html, []byte("<p>"))
+	html = bytes.TrimSuffix(html, []byte("</p>"))
+	return template.HTML(convertWikiMarkup(html))
+}
+
+// ViewQuery returns the query of a link to the page's view with one option
+// changed, or removed when value is empty, and the rest kept as they are.
+func (p *Page) ViewQuery(key, value string) string {
+	q := url.Values{}
+	if p.Measure != "" {
+		q.Set("measure", p.Measure)
+	}
+	switch p.Quantities {
+	case "fraction":
+		q.Set("frac", "1")
+	case "decimal":
+		q.Set("frac", "0")
+	}
+	if p.Layout != "" {
+		q.Set("layout", p.Layout)
+	}
+	if p.Per != "" {
+		q.Set("per", p.Per)
+	}
+
+	if value == "" {
+		q.Del(key)
+	} else {
+		q.Set(key, value)
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + q.Encode()
+}
@@ -0,0 +1,79 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// The layout of the LastCooked section.
+const cookedLayout = "2006-01-02"
+
+// cookedHandler stamps today's date on the recipe as the last time it was
+// cooked.
+func cookedHandler(w http.ResponseWriter, r *http.Request, title string) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := updatePage(title, func(p *Page) error {
+		p.LastCooked = time.Now().Format(cookedLayout)
+		return nil
+	})
+	if os.IsNotExist(err) {
+		notFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, basePath+"/view/"+title, http.StatusFound)
+}
+
+// leastRecentlyCookedHandler lists every recipe, those never cooked first and
+// then the rest from the longest ago to the most recent, to turn up recipes
+// which have been neglected.
+func leastRecentlyCookedHandler(w http.ResponseWriter, r *http.Request) {
+	s := &SearchPage{
+		Title: "Least Recently Cooked",
+		Query: "least recently cooked",
+		Theme: chooseTheme(w, r),
+		Index: pages}
+
+	var recipes []*Page
+	for _, entry := range pages[1:] {
+		if p, err := loadPage(entry.Filename); err == nil && p.Collection == "" {
+			recipes = append(recipes, p)
+		}
+	}
+	// The dates sort as strings, and never cooked sorts as empty.
+	sort.SliceStable(recipes, func(i, j int) bool {
+		return recipes[i].LastCooked < recipes[j].LastCooked
+	})
+
+	for _, p := range recipes {
+		cooked := "Never cooked."
+		if p.LastCooked != "" {
+			cooked = "Last cooked " + formatDate(p.LastCooked) + "."
+		}
+		s.Results = append(s.Results, SearchResult{
+			Title:    p.Title,
+			Filename: p.Filename,
+			Excerpt:  template.HTML(template.HTMLEscapeString(cooked))})
+	}
+
+	err := templates.ExecuteTemplate(w, "search.html", s)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A directive in the home page, such as {{recent 5}}, is replaced with a list
+// of links to recipes when the home page is shown.
+var directive = regexp.MustCompile(`\{\{\s*(recent|random)\s+(\d+)\s*\}\}`)
+
+// The most links a directive may list.
+const maxDirectiveLinks = 50
+
+// expandDirectives replaces each directive in the markdown of the home page
+// with a markdown list.  {{recent N}} lists the N recipes saved most recently
+// and {{random N}} lists N recipes picked at random.  A directive which cannot
+// be expanded, such as recent with a store which does not keep modification
+// times, is removed.
+func expandDirectives(body string) string {
+	return directive.ReplaceAllStringFunc(body, func(d string) string {
+		m := directive.FindStringSubmatch(d)
+		n, err := strconv.Atoi(m[2])
+		if err != nil || n <= 0 {
+			return ""
+		}
+		if n > maxDirectiveLinks {
+			n = maxDirectiveLinks
+		}
+
+		var entries []IndexEntry
+		switch m[1] {
+		case "recent":
+			entries = recentEntries(n)
+		case "random":
+			entries = randomEntries(n)
+		}
+		return markdownLinks(entries)
+	})
+}
+
+// recentEntries returns the n entries of the index saved most recently, or
+// none if the store cannot tell when pages were saved.
+func recentEntries(n int) []IndexEntry {
+	mt, ok := store.(modTimer)
+	if !ok {
+		return nil
+	}
+
+	type saved struct {
+		entry IndexEntry
+		when  time.Time
+	}
+	var all []saved
+	for _, entry := range pages[1:] {
+		when, err := mt.ModTime(entry.Filename)
+		if err != nil {
+			continue
+		}
+		all = append(all, saved{entry, when})
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].when.After(all[j].when) })
+
+	var entries []IndexEntry
+	for i := 0; i < n && i < len(all); i++ {
+		entries = append(entries, all[i].entry)
+	}
+	return entries
+}
+
+// randomEntries returns n different entries of the index picked at random.
+func randomEntries(n int) []IndexEntry {
+	entries := append([]IndexEntry(nil), pages[1:]...)
+	rand.Shuffle(len(entries), func(i, j int) { entries[i], entries[j] = entries[j], entries[i] })
+	if n < len(entries) {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// Characters which have to be escaped in the text of a markdown link.
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`, `*`, `\*`, `_`, `\_`, "`", "\\`")
+
+// markdownLinks writes the entries as a markdown list of links, set apart by
+// blank lines so that it is never read as part of a paragraph.
+func markdownLinks(entries []IndexEntry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\n")
+	for _, entry := range entries {
+		b.WriteString("- [" + markdownEscaper.Replace(entry.Title) + "](" + basePath + "/" + entry.Route + "/" + entry.Filename + ")\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
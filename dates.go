@@ -0,0 +1,53 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateLayout is how dates are shown, as a Go time layout.
+var dateLayout = "2006-01-02"
+
+// Named layouts which may be given in place of a Go layout.
+var datePresets = map[string]string{
+	"iso":  "2006-01-02",
+	"us":   "01/02/2006",
+	"eu":   "02/01/2006",
+	"long": "January 2, 2006",
+	"text": "Mon Jan 2, 2006"}
+
+// setDateFormat sets dateLayout from a preset name or a Go layout.
+func setDateFormat(format string) error {
+	if layout, ok := datePresets[strings.ToLower(format)]; ok {
+		dateLayout = layout
+		return nil
+	}
+
+	// A layout formats a time differently from the way it is written.
+	sample := time.Date(1999, 11, 23, 10, 30, 45, 0, time.UTC)
+	if sample.Format(format) == format {
+		return fmt.Errorf("%q is not a preset or a Go time layout", format)
+	}
+	dateLayout = format
+	return nil
+}
+
+// formatDate shows a time, or a date stored as YYYY-MM-DD, in dateLayout.
+// A string which is not such a date is returned as it is.
+func formatDate(v interface{}) string {
+	switch d := v.(type) {
+	case time.Time:
+		return d.Format(dateLayout)
+	case string:
+		if t, err := time.Parse(cookedLayout, d); err == nil {
+			return t.Format(dateLayout)
+		}
+		return d
+	}
+	return fmt.Sprint(v)
+}
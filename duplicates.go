@@ -0,0 +1,163 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Recipes sharing at least this fraction of their lines are reported as near
+// duplicates.
+const duplicateOverlap = 0.9
+
+// DuplicateGroup is a set of recipes with the same or nearly the same
+// ingredients and instructions.
+type DuplicateGroup struct {
+	Exact   bool
+	Recipes []IndexEntry
+}
+
+// DuplicatesPage is the model for the duplicates report.
+type DuplicatesPage struct {
+	Title  string
+	Groups []DuplicateGroup
+	Theme  string
+}
+
+// Markdown list markers, which are ignored when comparing lines.
+var listMarker = regexp.MustCompile(`^([-*+]|\d+[.)])\s+`)
+
+// comparableLines reduces a recipe to its ingredient and instruction lines,
+// without markdown, case or extra whitespace, so that formatting differences
+// do not hide a duplicate.
+func comparableLines(p *Page) []string {
+	var lines []string
+	text := string(p.Ingredients) + "\n" + string(p.Instructions)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		line = listMarker.ReplaceAllString(line, "")
+		line = strings.TrimLeft(plainText(line), "# ")
+		line = strings.ToLower(strings.Join(strings.Fields(line), " "))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// lineOverlap is the fraction of lines the two recipes share, out of the
+// longer of the two.
+func lineOverlap(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	count := make(map[string]int)
+	for _, line := range a {
+		count[line]++
+	}
+	shared := 0
+	for _, line := range b {
+		if count[line] > 0 {
+			count[line]--
+			shared++
+		}
+	}
+
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	return float64(shared) / float64(longest)
+}
+
+// findDuplicates groups the recipes in the index which are identical or
+// nearly so.  A recipe is grouped with every recipe it nearly matches, and
+// with any they match in turn.
+func findDuplicates() []DuplicateGroup {
+	var entries []IndexEntry
+	var lines [][]string
+	var sums [][sha256.Size]byte
+	for _, entry := range pages[1:] {
+		p, err := loadPage(entry.Filename)
+		if err != nil || p.Collection != "" {
+			continue
+		}
+		l := comparableLines(p)
+		if len(l) == 0 {
+			continue
+		}
+		entries = append(entries, entry)
+		lines = append(lines, l)
+		sums = append(sums, sha256.Sum256([]byte(strings.Join(l, "\n"))))
+	}
+
+	// group[i] is the index of the first recipe in i's group.
+	group := make([]int, len(entries))
+	for i := range group {
+		group[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if group[i] != i {
+			group[i] = find(group[i])
+		}
+		return group[i]
+	}
+
+	for i := range entries {
+		for j := i + 1; j < len(entries); j++ {
+			if sums[i] == sums[j] || lineOverlap(lines[i], lines[j]) >= duplicateOverlap {
+				a, b := find(i), find(j)
+				if a > b {
+					a, b = b, a
+				}
+				group[b] = a
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	var order []int
+	for i := range entries {
+		root := find(i)
+		if _, ok := members[root]; !ok {
+			order = append(order, root)
+		}
+		members[root] = append(members[root], i)
+	}
+
+	var groups []DuplicateGroup
+	for _, root := range order {
+		if len(members[root]) < 2 {
+			continue
+		}
+		g := DuplicateGroup{Exact: true}
+		for _, i := range members[root] {
+			g.Recipes = append(g.Recipes, entries[i])
+			if sums[i] != sums[root] {
+				g.Exact = false
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// duplicatesHandler reports the groups of duplicate recipes.
+func duplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	d := &DuplicatesPage{
+		Title:  "Duplicate Recipes",
+		Groups: findDuplicates(),
+		Theme:  chooseTheme(w, r)}
+
+	err := templates.ExecuteTemplate(w, "duplicates.html", d)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+)
+
+// ErrorPage is the model for the 404.html and 500.html templates.
+type ErrorPage struct {
+	Title   string
+	Message string
+	Theme   string
+	Index   Pages
+}
+
+// renderError responds with the status using the error template, in the
+// wiki's own style.  If the template is missing or fails it falls back to a
+// plain response like http.Error.
+func renderError(w http.ResponseWriter, r *http.Request, status int, tmpl, message string) {
+	var t *template.Template
+	if templates != nil {
+		t = templates.Lookup(tmpl)
+	}
+	if t == nil || len(pages) == 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	e := &ErrorPage{
+		Title:   http.StatusText(status),
+		Message: message,
+		Theme:   chooseTheme(w, r),
+		Index:   pages}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, e); err != nil {
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// notFound is the wiki's version of http.NotFound.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	renderError(w, r, http.StatusNotFound, "404.html", "404 page not found")
+}
+
+// serverError responds 500 Internal Server Error with the error's message.
+func serverError(w http.ResponseWriter, r *http.Request, err error) {
+	renderError(w, r, http.StatusInternalServerError, "500.html", err.Error())
+}
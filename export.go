@@ -0,0 +1,149 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The exported site is meant to be published, so unlike the wiki's own files
+// it is readable by everyone.
+const exportPerm = 0044
+
+// exportStatic renders the home page and every recipe and menu into a
+// standalone html file in dir, and copies the resources alongside them, so
+// that the wiki can be published as a static site.  Each page is rendered and
+// written before the next is loaded, so a large wiki is never held in memory
+// at once.
+func exportStatic(dir string) error {
+	if err := os.MkdirAll(dir, dirMode|exportPerm|0011); err != nil {
+		return err
+	}
+
+	for _, entry := range pages {
+		html, err := renderStatic(entry)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// Pages in a category are written to a subdirectory.
+		depth := strings.Count(entry.Filename, "/")
+		html = relativeLinks(html, strings.Repeat("../", depth))
+
+		target, err := safePagePath(dir, entry.Filename, ".html")
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), dirMode|exportPerm|0011); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(target, html, fileMode|exportPerm); err != nil {
+			return err
+		}
+	}
+
+	return copyDir("resources", filepath.Join(dir, "resources"))
+}
+
+// renderStatic renders the page for an index entry as it would be served.
+func renderStatic(entry IndexEntry) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if entry.Filename == rootTitle {
+		p, err := loadRoot(entry.Filename)
+		if err != nil {
+			return nil, err
+		}
+		renderRoot(p)
+		p.Theme = defaultTheme
+		err = templates.ExecuteTemplate(&buf, "root.html", p)
+		return buf.Bytes(), err
+	}
+
+	if entry.Route == "menu" {
+		m, err := loadMenu(entry.Filename, 0)
+		if err != nil {
+			return nil, err
+		}
+		m.Theme = defaultTheme
+		err = templates.ExecuteTemplate(&buf, "menu.html", m)
+		return buf.Bytes(), err
+	}
+
+	p, err := loadPage(entry.Filename)
+	if err != nil {
+		return nil, err
+	}
+	renderPage(p)
+	p.Index = pages
+	p.Theme = defaultTheme
+	err = templates.ExecuteTemplate(&buf, "view.html", p)
+	return buf.Bytes(), err
+}
+
+// relativeLinks rewrites the links between pages to point at the exported
+// html files, and the links to resources to the copied directory.  up leads
+// from the page's directory back to the top of the export.
+func relativeLinks(html []byte, up string) []byte {
+	prefix := regexp.QuoteMeta(basePath)
+	pageLink := regexp.MustCompile(`(href|src)="` + prefix + `/(view|menu)/(` + filenamePattern + `)"`)
+	resourceLink := regexp.MustCompile(`(href|src)="` + prefix + `/resources/`)
+
+	html = pageLink.ReplaceAll(html, []byte(`$1="`+up+`$3.html"`))
+	return resourceLink.ReplaceAll(html, []byte(`$1="`+up+`resources/`))
+}
+
+// copyDir copies the files in src, and its subdirectories, into dst.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, dirMode|exportPerm|0011)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		return copyFile(path, target)
+	})
+}
+
+// copyFile copies src to dst a piece at a time, so that a large photo is
+// never held in memory whole.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileMode|exportPerm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,74 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestCopyDirBoundedMemory exports a directory holding one large file and many
+// small ones, and checks that the copy allocates far less than the large file,
+// so that it is streamed rather than read whole.
+func TestCopyDirBoundedMemory(t *testing.T) {
+	const size = 7 << 23 // 56MB, a multiple of the chunk written below
+	src := filepath.Join(t.TempDir(), "resources")
+	dst := filepath.Join(t.TempDir(), "resources")
+
+	if err := os.MkdirAll(filepath.Join(src, "photos"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(src, "photos", "large.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := bytes.Repeat([]byte("recipe\n"), 1<<13)
+	for written := 0; written < size; written += len(chunk) {
+		if _, err := f.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		name := filepath.Join(src, fmt.Sprintf("small-%d.css", i))
+		if err := ioutil.WriteFile(name, []byte("body {}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	if err := copyDir(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > size/8 {
+		t.Errorf("copyDir allocated %d bytes copying a %d byte file", alloc, size)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "photos", "large.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != size {
+		t.Errorf("copied file has %d bytes, want %d", info.Size(), size)
+	}
+	files, err := ioutil.ReadDir(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 501 {
+		t.Errorf("copied %d entries, want 501", len(files))
+	}
+}
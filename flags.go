@@ -0,0 +1,113 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Flags mark recipes which need some work, such as "needs photo" or "needs
+// testing".  They are kept apart from the tags, in the Flags section, since
+// they say nothing about the recipe itself and are meant to be cleared.
+
+// flagKey is how a flag is written in the URL of its listing, and what flags
+// are compared by: lowercase, with hyphens for spaces.
+func flagKey(flag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(flag), "-"))
+}
+
+// toggleFlag removes flag from the list when it is there and adds it when it
+// is not.
+func toggleFlag(flags []string, flag string) []string {
+	var kept []string
+	for _, f := range flags {
+		if flagKey(f) != flagKey(flag) {
+			kept = append(kept, f)
+		}
+	}
+	if len(kept) == len(flags) {
+		kept = append(kept, flag)
+	}
+	return kept
+}
+
+// flagHandler turns the flag named by the flag parameter on or off for a
+// recipe and then shows the recipe again.
+func flagHandler(w http.ResponseWriter, r *http.Request, title string) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flag := strings.TrimSpace(r.FormValue("flag"))
+	if flag == "" || strings.ContainsAny(flag, ",\n") {
+		http.Error(w, "flag must name a single flag.", http.StatusBadRequest)
+		return
+	}
+	if _, ok := sectionMarker(flag); ok || hasCommentMarkup(flag) {
+		http.Error(w, errSectionMarker.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := updatePage(title, func(p *Page) error {
+		p.Flags = toggleFlag(p.Flags, flag)
+		return nil
+	})
+	if os.IsNotExist(err) {
+		notFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, basePath+"/view/"+title, http.StatusFound)
+}
+
+// flaggedHandler lists the recipes with the flag named in the path, like
+// /flagged/needs-photo, or every flagged recipe for /flagged/ alone.
+func flaggedHandler(w http.ResponseWriter, r *http.Request) {
+	want := flagKey(strings.TrimPrefix(r.URL.Path, "/flagged/"))
+
+	s := &SearchPage{
+		Title: "Flagged Recipes",
+		Query: "flagged",
+		Theme: chooseTheme(w, r),
+		Index: pages}
+	if want != "" {
+		s.Title = "Flagged " + strings.Replace(want, "-", " ", -1)
+		s.Query = "flagged " + strings.Replace(want, "-", " ", -1)
+	}
+
+	for _, entry := range pages[1:] {
+		p, err := loadPage(entry.Filename)
+		if err != nil || len(p.Flags) == 0 {
+			continue
+		}
+		found := want == ""
+		for _, f := range p.Flags {
+			if flagKey(f) == want {
+				found = true
+			}
+		}
+		if !found {
+			continue
+		}
+		s.Results = append(s.Results, SearchResult{
+			Title:    p.Title,
+			Filename: p.Filename,
+			Excerpt:  template.HTML(template.HTMLEscapeString("Flagged " + strings.Join(p.Flags, ", ") + "."))})
+	}
+
+	err := templates.ExecuteTemplate(w, "search.html", s)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
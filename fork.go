@@ -0,0 +1,85 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"os"
+)
+
+// forkHandler copies a recipe into a new page, which records the filename of
+// the recipe it was adapted from, and opens the copy for editing.
+func forkHandler(w http.ResponseWriter, r *http.Request, title string) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parent, err := loadPage(title)
+	if os.IsNotExist(err) {
+		notFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	fork := *parent
+	fork.Title = parent.Title + " (adapted)"
+	fork.ID = ""
+	fork.ForkedFrom = parent.Filename
+	fork.LastCooked = ""
+	fork.Author = ""
+	credit(&fork, editorName(r))
+
+	err = savePage(&fork, "")
+	if err == errTooManyRecipes {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, basePath+"/edit/"+fork.Filename, http.StatusFound)
+}
+
+// forksHandler lists the recipes adapted from a recipe.
+func forksHandler(w http.ResponseWriter, r *http.Request, title string) {
+	s := &SearchPage{
+		Title: "Recipes adapted from " + indexTitle(title),
+		Query: title,
+		Theme: chooseTheme(w, r),
+		Index: pages}
+
+	for _, entry := range pages[1:] {
+		p, err := loadPage(entry.Filename)
+		if err != nil || p.ForkedFrom != title {
+			continue
+		}
+		s.Results = append(s.Results, SearchResult{
+			Title:    p.Title,
+			Filename: p.Filename})
+	}
+
+	err := templates.ExecuteTemplate(w, "search.html", s)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// indexTitle returns the title of the page with the given filename, or a
+// title made from the filename if the page is not in the index.
+func indexTitle(filename string) string {
+	for _, entry := range pages {
+		if entry.Filename == filename {
+			return entry.Title
+		}
+	}
+	return convertFilenameToTitle(filename)
+}
@@ -0,0 +1,67 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Short words left in lower case by titleCase unless they come first.
+var minorWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "but": true,
+	"by": true, "for": true, "in": true, "of": true, "on": true, "or": true,
+	"the": true, "to": true, "with": true}
+
+// titleCase capitalizes the first letter of each word but the minor ones.
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		if i > 0 && minorWords[strings.ToLower(word)] {
+			words[i] = strings.ToLower(word)
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToUpper(r)) + word[size:]
+	}
+	return strings.Join(words, " ")
+}
+
+// pluralize returns the count followed by the word, made plural unless the
+// count is one, like "1 egg" or "3 eggs".  The count may be an int or a
+// float64, which is written as a fraction.
+func pluralize(count interface{}, word string) (string, error) {
+	var n float64
+	switch c := count.(type) {
+	case int:
+		n = float64(c)
+	case float64:
+		n = c
+	default:
+		return "", fmt.Errorf("pluralize: cannot count with %T", count)
+	}
+
+	if n != 1 {
+		word = plural(word)
+	}
+	return formatQuantity(n) + " " + word, nil
+}
+
+// plural returns the regular plural of an English noun.
+func plural(word string) string {
+	lower := strings.ToLower(word)
+	switch {
+	case word == "":
+		return word
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return word + "es"
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return word[:len(word)-1] + "ies"
+	}
+	return word + "s"
+}
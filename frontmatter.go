@@ -0,0 +1,158 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+)
+
+// When frontmatter is set, a page which starts with a block of YAML fenced by
+// --- lines, as Markdown tools write them, is read as well as one with only
+// section markers.
+var frontmatter = true
+
+// The frontmatter keys which are read, and the sections they fill.  Other
+// keys are ignored.
+var frontmatterSections = map[string]string{
+	"title":    "Title",
+	"tags":     "Tags",
+	"servings": "Servings",
+	"source":   "Source"}
+
+// splitFrontmatter separates the frontmatter at the start of content from the
+// rest of it.  It returns false when content does not start with a fenced
+// block.
+func splitFrontmatter(content string) (meta []string, rest string, ok bool) {
+	lines := strings.Split(strings.TrimPrefix(content, "\ufeff"), "\n")
+	if len(lines) == 0 || strings.TrimRight(lines[0], " \t\r") != "---" {
+		return nil, "", false
+	}
+	for i := 1; i < len(lines); i++ {
+		if fence := strings.TrimRight(lines[i], " \t\r"); fence == "---" || fence == "..." {
+			return lines[1:i], strings.Join(lines[i+1:], "\n"), true
+		}
+	}
+	return nil, "", false
+}
+
+// parseFrontmatter reads the simple YAML frontmatter is written in: lines of
+// "key: value", where the value may be quoted or an inline list like [a, b],
+// or a key followed by lines of "- item".  Lists are joined with commas.
+// Anything more complicated is ignored.
+func parseFrontmatter(meta []string) map[string]string {
+	values := make(map[string]string)
+	var listKey string
+	var list []string
+
+	endList := func() {
+		if listKey != "" {
+			values[listKey] = strings.Join(list, ", ")
+		}
+		listKey, list = "", nil
+	}
+
+	for _, line := range meta {
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- ") && listKey != "" {
+			list = append(list, unquoteYAML(strings.TrimPrefix(trimmed, "- ")))
+			continue
+		}
+		endList()
+
+		// Nested values are indented and not read.
+		if line != trimmed {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch {
+		case value == "":
+			listKey = key
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			var items []string
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = unquoteYAML(strings.TrimSpace(item)); item != "" {
+					items = append(items, item)
+				}
+			}
+			values[key] = strings.Join(items, ", ")
+		default:
+			values[key] = unquoteYAML(value)
+		}
+	}
+	endList()
+
+	return values
+}
+
+// unquoteYAML removes the quotes around a YAML string, or a trailing comment
+// from one which is not quoted.
+func unquoteYAML(value string) string {
+	if len(value) >= 2 {
+		if q := value[0]; (q == '"' || q == '\'') && value[len(value)-1] == q {
+			inner := value[1 : len(value)-1]
+			if q == '\'' {
+				return strings.Replace(inner, "''", "'", -1)
+			}
+			return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(inner)
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+// parseFrontmatterRecipe reads a page which starts with frontmatter.  The
+// frontmatter fills in the sections it names, and sections marked in the
+// rest of the page take precedence.  When the rest has no section markers, as
+// in a plain Markdown file, it is divided at headings like "## Ingredients",
+// or else all taken as the instructions.
+func parseFrontmatterRecipe(meta []string, rest string) (map[string]string, error) {
+	sections := make(map[string]string)
+	for key, value := range parseFrontmatter(meta) {
+		if name, ok := frontmatterSections[key]; ok && value != "" {
+			sections[name] = value
+		}
+	}
+
+	lines := strings.Split(rest, "\n")
+	marked := false
+	for _, line := range lines {
+		if _, ok := sectionMarker(line); ok {
+			marked = true
+			break
+		}
+	}
+
+	if marked {
+		body, err := parseSections([]byte(rest))
+		if err != nil {
+			return nil, err
+		}
+		for name, text := range body {
+			sections[name] = text
+		}
+		return sections, nil
+	}
+
+	if ingredients, instructions, ok := splitByHeadings(lines); ok {
+		sections["Ingredients"] = strings.TrimSpace(strings.Join(ingredients, "\n")) + "\n"
+		sections["Instructions"] = strings.TrimSpace(strings.Join(instructions, "\n")) + "\n"
+	} else if text := strings.TrimSpace(rest); text != "" {
+		sections["Instructions"] = text + "\n"
+	}
+	return sections, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshots of pages are kept in pagesDir/.history/<filename>/.  The leading
+// dot keeps them out of the index.
+var historyDir string = ".history"
+
+// The layout used to name snapshot files.
+const snapshotLayout = "20060102T150405.000000000Z"
+
+// A historyStore keeps the snapshots of its pages itself.  The snapshots of
+// any other store are kept in files in historyDir.
+type historyStore interface {
+	Snapshot(filename, stamp string) error
+	Snapshots(filename string) ([]string, error)
+	LoadSnapshot(filename, stamp string) ([]byte, error)
+}
+
+// historyPath returns the directory a page's snapshots are kept in.
+func historyPath(filename string) (string, error) {
+	return safePagePath(filepath.Join(pagesDir, historyDir), filename, "")
+}
+
+// snapshotPage copies the current contents of a page into the history
+// directory so that it can be recovered after a destructive change.
+func snapshotPage(filename string) error {
+	stamp := time.Now().UTC().Format(snapshotLayout)
+	if hs, ok := store.(historyStore); ok {
+		return hs.Snapshot(filename, stamp)
+	}
+
+	body, err := store.Load(filename)
+	if err != nil {
+		return err
+	}
+
+	dir, err := historyPath(filename)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, stamp+pageExt), body, fileMode)
+}
+
+// listSnapshots returns the timestamps of a page's snapshots, oldest first.
+// A page without any has none.
+func listSnapshots(filename string) ([]string, error) {
+	if hs, ok := store.(historyStore); ok {
+		return hs.Snapshots(filename)
+	}
+
+	dir, err := historyPath(filename)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stamps []string
+	for _, f := range files {
+		stamp := strings.TrimSuffix(f.Name(), pageExt)
+		if _, err := time.Parse(snapshotLayout, stamp); err == nil && !f.IsDir() {
+			stamps = append(stamps, stamp)
+		}
+	}
+	sort.Strings(stamps)
+	return stamps, nil
+}
+
+// loadSnapshot reads the snapshot of a page taken at the timestamp.
+func loadSnapshot(filename, stamp string) ([]byte, error) {
+	if _, err := time.Parse(snapshotLayout, stamp); err != nil {
+		return nil, os.ErrNotExist
+	}
+	if hs, ok := store.(historyStore); ok {
+		return hs.LoadSnapshot(filename, stamp)
+	}
+	dir, err := historyPath(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filepath.Join(dir, stamp+pageExt))
+}
@@ -0,0 +1,351 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// htmlNode is an element of a pasted HTML fragment.  Text is held in nodes
+// with an empty tag.
+type htmlNode struct {
+	tag      string
+	attrs    string
+	text     string
+	children []*htmlNode
+}
+
+var htmlToken = regexp.MustCompile(`(?s)<(/?)([a-zA-Z][a-zA-Z0-9]*)([^>]*)>`)
+var htmlDropped = regexp.MustCompile(`(?is)<script\b.*?</script\s*>|<style\b.*?</style\s*>|<!--.*?-->|<!doctype[^>]*>`)
+
+// Elements which never have children.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true,
+	"img": true, "input": true, "link": true, "meta": true, "source": true, "wbr": true}
+
+// parseHTMLFragment builds a tree from an HTML fragment.  Scripts, styles and
+// comments are dropped.  It is forgiving rather than correct: an end tag with
+// no open element closes nothing, and one which skips over open elements
+// closes them too.
+func parseHTMLFragment(fragment string) *htmlNode {
+	fragment = htmlDropped.ReplaceAllString(fragment, "")
+	root := &htmlNode{tag: "root"}
+	stack := []*htmlNode{root}
+
+	addText := func(text string) {
+		if text != "" {
+			top := stack[len(stack)-1]
+			top.children = append(top.children, &htmlNode{text: html.UnescapeString(text)})
+		}
+	}
+
+	last := 0
+	for _, m := range htmlToken.FindAllStringSubmatchIndex(fragment, -1) {
+		addText(fragment[last:m[0]])
+		last = m[1]
+
+		tag := strings.ToLower(fragment[m[4]:m[5]])
+		if m[3] > m[2] {
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].tag == tag {
+					stack = stack[:i]
+					break
+				}
+			}
+			continue
+		}
+
+		n := &htmlNode{tag: tag, attrs: fragment[m[6]:m[7]]}
+		top := stack[len(stack)-1]
+		top.children = append(top.children, n)
+		if !voidElements[tag] && !strings.HasSuffix(n.attrs, "/") {
+			stack = append(stack, n)
+		}
+	}
+	addText(fragment[last:])
+
+	return root
+}
+
+var htmlAttr = regexp.MustCompile(`([a-zA-Z][-a-zA-Z0-9:]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+
+// attr returns the value of the named attribute, or "" if it has none.
+func (n *htmlNode) attr(name string) string {
+	for _, m := range htmlAttr.FindAllStringSubmatch(n.attrs, -1) {
+		if strings.EqualFold(m[1], name) {
+			return html.UnescapeString(m[2] + m[3] + m[4])
+		}
+	}
+	return ""
+}
+
+// hasItemprop reports whether the element carries any of the microdata
+// properties.
+func (n *htmlNode) hasItemprop(props ...string) bool {
+	for _, have := range strings.Fields(n.attr("itemprop")) {
+		for _, prop := range props {
+			if have == prop {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var blockElements = map[string]bool{
+	"p": true, "div": true, "li": true, "br": true, "tr": true, "section": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true}
+
+// lines returns the text of the element, one line per block element inside
+// it, with the whitespace of each line collapsed.
+func (n *htmlNode) lines() []string {
+	var b strings.Builder
+	var walk func(*htmlNode)
+	walk = func(n *htmlNode) {
+		if n.tag == "" {
+			b.WriteString(n.text)
+			return
+		}
+		if blockElements[n.tag] {
+			b.WriteString("\n")
+		}
+		for _, c := range n.children {
+			walk(c)
+		}
+		if blockElements[n.tag] {
+			b.WriteString("\n")
+		}
+	}
+	walk(n)
+
+	var lines []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// flatText returns the text of the element on a single line.
+func (n *htmlNode) flatText() string {
+	return strings.Join(n.lines(), " ")
+}
+
+// find returns the elements under n, in document order, for which match is
+// true.  The children of a matching element are not searched.
+func (n *htmlNode) find(match func(*htmlNode) bool) []*htmlNode {
+	var found []*htmlNode
+	for _, c := range n.children {
+		if c.tag == "" {
+			continue
+		}
+		if match(c) {
+			found = append(found, c)
+			continue
+		}
+		found = append(found, c.find(match)...)
+	}
+	return found
+}
+
+// listItems returns the text of each item of the lists in n, or nil if it
+// has no list.
+func (n *htmlNode) listItems() []string {
+	var items []string
+	for _, li := range n.find(func(c *htmlNode) bool { return c.tag == "li" }) {
+		if text := li.flatText(); text != "" {
+			items = append(items, text)
+		}
+	}
+	return items
+}
+
+var ingredientHeading = regexp.MustCompile(`(?i)ingredient`)
+var instructionHeading = regexp.MustCompile(`(?i)instruction|direction|method|preparation|steps`)
+
+// importHTML converts a pasted HTML recipe into a page.  It uses schema.org
+// microdata when the fragment has it, and otherwise looks for lists under
+// headings like "Ingredients" and "Directions".  When it cannot tell the
+// sections apart all of the text goes into the instructions and confident is
+// false.
+func importHTML(fragment string) (p *Page, confident bool) {
+	root := parseHTMLFragment(fragment)
+	p = &Page{}
+
+	microdata := func(n *htmlNode) bool {
+		return n.hasItemprop("name", "recipeYield", "recipeIngredient", "ingredients", "recipeInstructions")
+	}
+
+	var ingredients, instructions []string
+	for _, n := range root.find(microdata) {
+		value := n.flatText()
+		if n.tag == "meta" {
+			value = n.attr("content")
+		}
+		switch {
+		case n.hasItemprop("name") && p.Title == "":
+			p.Title = value
+		case n.hasItemprop("recipeYield") && p.Servings == "":
+			p.Servings = value
+		case n.hasItemprop("recipeIngredient", "ingredients"):
+			ingredients = append(ingredients, value)
+		case n.hasItemprop("recipeInstructions"):
+			if items := n.listItems(); items != nil {
+				instructions = append(instructions, items...)
+			} else {
+				instructions = append(instructions, n.lines()...)
+			}
+		}
+	}
+
+	if ingredients == nil && instructions == nil {
+		ingredients, instructions = sectionsByHeading(root)
+	}
+
+	if p.Title == "" {
+		if h := root.find(func(c *htmlNode) bool { return c.tag == "h1" }); h != nil {
+			p.Title = h[0].flatText()
+		}
+	}
+
+	confident = ingredients != nil && instructions != nil
+	if !confident {
+		ingredients = nil
+		instructions = root.lines()
+	}
+
+	var b strings.Builder
+	for _, line := range ingredients {
+		b.WriteString("- " + line + "\n")
+	}
+	p.Ingredients = template.HTML(b.String())
+
+	b.Reset()
+	for _, line := range instructions {
+		if confident {
+			b.WriteString("1. ")
+		}
+		b.WriteString(line + "\n")
+		if !confident {
+			b.WriteString("\n")
+		}
+	}
+	p.Instructions = template.HTML(b.String())
+
+	return p, confident
+}
+
+// sectionsByHeading finds the ingredients and instructions of a fragment
+// without microdata.  Each list belongs to the section named by the heading
+// before it.  With no such headings a bulleted list followed by a numbered
+// one is taken to be the ingredients and then the instructions.
+func sectionsByHeading(root *htmlNode) (ingredients, instructions []string) {
+	isHeading := func(n *htmlNode) bool {
+		return len(n.tag) == 2 && n.tag[0] == 'h' && n.tag[1] >= '1' && n.tag[1] <= '6'
+	}
+	blocks := root.find(func(n *htmlNode) bool {
+		return isHeading(n) || n.tag == "ul" || n.tag == "ol" || n.tag == "p"
+	})
+
+	section := ""
+	for _, n := range blocks {
+		switch {
+		case isHeading(n):
+			text := n.flatText()
+			if ingredientHeading.MatchString(text) {
+				section = "ingredients"
+			} else if instructionHeading.MatchString(text) {
+				section = "instructions"
+			} else {
+				section = ""
+			}
+		case section == "ingredients" && n.tag != "p":
+			ingredients = append(ingredients, n.listItems()...)
+		case section == "instructions" && n.tag == "p":
+			instructions = append(instructions, n.lines()...)
+		case section == "instructions":
+			instructions = append(instructions, n.listItems()...)
+		}
+	}
+	if ingredients != nil || instructions != nil {
+		return ingredients, instructions
+	}
+
+	var ul, ol *htmlNode
+	for _, n := range blocks {
+		if n.tag == "ul" && ul == nil {
+			ul = n
+		}
+		if n.tag == "ol" && ul != nil && ol == nil {
+			ol = n
+		}
+	}
+	if ul != nil && ol != nil {
+		return ul.listItems(), ol.listItems()
+	}
+	return nil, nil
+}
+
+// ImportPage is the model for the HTML import form.
+type ImportPage struct {
+	Title    string
+	Imported *Page // the page saved, when the import was not confident
+	Theme    string
+	Index    Pages
+}
+
+// importHandler shows forms to paste an HTML recipe or a plain text one
+// into.  A POST of HTML converts the recipe and saves it, then shows it.
+// When the sections could not be told apart it stays on the form to say so,
+// with a link to the new page.  Text is handed to importTextHandler.
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" && r.FormValue("text") != "" {
+		importTextHandler(w, r)
+		return
+	}
+
+	m := &ImportPage{
+		Title: "Import a Recipe",
+		Theme: chooseTheme(w, r),
+		Index: pages}
+
+	if r.Method == "POST" {
+		p, confident := importHTML(r.FormValue("html"))
+		if title := strings.TrimSpace(r.FormValue("recipeTitle")); title != "" {
+			p.Title = title
+		}
+		if p.Title == "" {
+			p.Title = "Imported Recipe"
+		}
+		credit(p, editorName(r))
+
+		err := savePage(p, "")
+		if err == errTooManyRecipes {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			serverError(w, r, err)
+			return
+		}
+
+		if confident {
+			http.Redirect(w, r, basePath+"/view/"+p.Filename, http.StatusFound)
+			return
+		}
+		m.Imported = p
+		m.Index = pages
+	}
+
+	err := templates.ExecuteTemplate(w, "import.html", m)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"strings"
+	"unicode"
+)
+
+// Words in an ingredient's name which describe it rather than name it.  They
+// are ignored when looking for the ingredient in the instructions.
+var ingredientDescriptors = map[string]bool{
+	"large": true, "medium": true, "small": true, "fresh": true, "dried": true,
+	"chopped": true, "diced": true, "minced": true, "sliced": true, "ground": true,
+	"whole": true, "and": true, "or": true, "of": true, "the": true, "for": true,
+	"to": true, "taste": true, "optional": true, "plus": true, "more": true}
+
+// stem reduces a word to a rough singular so that "eggs" matches "egg".
+func stem(word string) string {
+	switch {
+	case strings.HasSuffix(word, "oes"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss"):
+		return strings.TrimSuffix(word, "s")
+	}
+	return word
+}
+
+// words splits text into lower case stemmed words.
+func words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for i, f := range fields {
+		fields[i] = stem(f)
+	}
+	return fields
+}
+
+// unusedIngredients returns the ingredients whose names never appear in the
+// instructions.  An ingredient counts as used if any word of its name, other
+// than descriptions like "large" or "chopped", appears.  It is only a hint, so
+// it errs towards saying an ingredient is used.
+func unusedIngredients(ingredients, instructions template.HTML) []string {
+	mentioned := make(map[string]bool)
+	for _, w := range words(string(instructions)) {
+		mentioned[w] = true
+	}
+
+	var unused []string
+	for _, line := range ingredientLines(ingredients) {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name := ingredientName(line)
+		used, significant := false, false
+		for _, w := range words(name) {
+			if ingredientDescriptors[w] || len(w) < 3 {
+				continue
+			}
+			significant = true
+			if mentioned[w] {
+				used = true
+				break
+			}
+		}
+
+		if significant && !used {
+			unused = append(unused, name)
+		}
+	}
+
+	return unused
+}
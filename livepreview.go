@@ -0,0 +1,81 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// When livePreview is set the edit page shows the recipe rendered as it is
+// typed, sent to and from the server over a WebSocket.
+var livePreview bool
+
+// How long a live preview connection may go without a message before it is
+// closed.
+var livePreviewIdle = 15 * time.Minute
+
+// livePreviewRequest is what the edit page sends whenever the recipe changes.
+type livePreviewRequest struct {
+	Title        string `json:"title"`
+	Ingredients  string `json:"ingredients"`
+	Instructions string `json:"instructions"`
+}
+
+// livePreviewResponse is the recipe rendered as the view would show it.
+type livePreviewResponse struct {
+	Ingredients  template.HTML `json:"ingredients,omitempty"`
+	Instructions template.HTML `json:"instructions,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// livePreviewHandler renders each recipe the edit page sends over a WebSocket
+// and sends the html back.  Nothing is saved.  It is only served with the
+// -live-preview flag.
+func livePreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if !livePreview {
+		notFound(w, r)
+		return
+	}
+
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.close(wsNormalClosure)
+
+	limit := int64(1 << 20)
+	if maxRenderSize > 0 {
+		limit = int64(maxRenderSize) + 4096
+	}
+
+	for {
+		message, err := conn.readMessage(limit, livePreviewIdle)
+		if err != nil {
+			return
+		}
+
+		var req livePreviewRequest
+		var resp livePreviewResponse
+		if err := json.Unmarshal([]byte(message), &req); err != nil {
+			resp.Error = "invalid JSON: " + err.Error()
+		} else {
+			p := &Page{
+				Title:        req.Title,
+				Ingredients:  template.HTML(req.Ingredients),
+				Instructions: template.HTML(req.Instructions)}
+			p.Truncated = truncatePage(p)
+			renderPage(p)
+			resp.Ingredients, resp.Instructions = p.Ingredients, p.Instructions
+		}
+
+		body, _ := json.Marshal(resp)
+		if err := conn.writeMessage(string(body)); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The meal plan is kept in this file in pagesDir with one "Day: filename" line
+// per planned day.
+var mealPlanFile string = ".mealplan"
+
+var weekdays = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+// MealDay is one day of the meal plan.  Filename is empty when nothing is
+// planned for the day.
+type MealDay struct {
+	Day      string
+	Filename string
+	Title    string
+}
+
+// MealPlanPage is the printable meal plan for the week.
+type MealPlanPage struct {
+	Title       string
+	Days        []MealDay
+	Ingredients []string
+	Choices     Pages
+	Theme       string
+}
+
+// loadMealPlan reads the meal plan, mapping each day to a recipe filename.
+// It must be run by the metadata writer.
+func loadMealPlan() (map[string]string, error) {
+	body, err := ioutil.ReadFile(filepath.Join(pagesDir, mealPlanFile))
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make(map[string]string)
+	for _, line := range strings.Split(string(body), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			plan[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return plan, nil
+}
+
+// saveMealPlan writes out the meal plan in weekday order.  It must be run by
+// the metadata writer.
+func saveMealPlan(plan map[string]string) error {
+	var body string
+	for _, day := range weekdays {
+		if plan[day] != "" {
+			body += day + ": " + plan[day] + "\n"
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(pagesDir, mealPlanFile), []byte(body), fileMode)
+}
+
+// mealPlanHandler shows the week's meal plan and its shopping list.  A POST
+// assigns the recipe named by each day's form field to that day.
+func mealPlanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		plan := make(map[string]string)
+		for _, day := range weekdays {
+			if name := r.FormValue(day); validTitle.MatchString(name) {
+				plan[day] = name
+			}
+		}
+
+		if err := withMeta(func() error { return saveMealPlan(plan) }); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, basePath+"/mealplan", http.StatusFound)
+		return
+	}
+
+	var plan map[string]string
+	err := withMeta(func() (err error) {
+		plan, err = loadMealPlan()
+		return err
+	})
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	m := &MealPlanPage{
+		Title:   "Meal Plan",
+		Choices: pages[1:],
+		Theme:   chooseTheme(w, r)}
+
+	var recipes []*Page
+	for _, day := range weekdays {
+		d := MealDay{Day: day}
+		if p, err := loadPage(plan[day]); plan[day] != "" && err == nil {
+			d.Filename = p.Filename
+			d.Title = p.Title
+			recipes = append(recipes, p)
+		}
+		m.Days = append(m.Days, d)
+	}
+	m.Ingredients = mergeIngredients(recipes)
+
+	err = templates.ExecuteTemplate(w, "mealplan.html", m)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
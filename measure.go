@@ -0,0 +1,92 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"html/template"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// density is how much a cup of an ingredient weighs.
+type density struct {
+	name        []string // the stemmed words of the name
+	gramsPerCup float64
+}
+
+//go:embed data/density.csv
+var densityData []byte
+
+// densityTable is parsed from densityData, longest names first so that
+// "brown sugar" is matched before "sugar".
+var densityTable = parseDensityTable(densityData)
+
+func parseDensityTable(data []byte) []density {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	rows, err := r.ReadAll()
+	if err != nil {
+		log.Fatalf("unable to read the density table: %v", err)
+	}
+
+	var table []density
+	for _, row := range rows[1:] {
+		grams, err := strconv.ParseFloat(row[1], 64)
+		if err != nil {
+			log.Fatalf("unable to read the density table: %v", err)
+		}
+		table = append(table, density{name: words(row[0]), gramsPerCup: grams})
+	}
+	sort.SliceStable(table, func(i, j int) bool {
+		return len(table[i].name) > len(table[j].name)
+	})
+	return table
+}
+
+// toWeight rewrites each ingredient measured by volume in grams, when the
+// ingredient is in the density table.  Every other line is left as it is.
+func toWeight(ingredients template.HTML) template.HTML {
+	lines := strings.Split(string(ingredients), "\n")
+	for i, line := range lines {
+		in, ok := parseIngredient(strings.TrimSuffix(line, "\r"))
+		if !ok {
+			continue
+		}
+		cups, ok := convertQuantity(in.Quantity, in.Unit, "cup")
+		if !ok || in.Unit == "" {
+			continue
+		}
+
+		have := words(ingredientName(line))
+		for _, d := range densityTable {
+			if !containsWords(have, d.name) {
+				continue
+			}
+
+			amount := formatGrams(cups * d.gramsPerCup)
+			if in.Max != 0 {
+				amount += "–" + formatGrams(cups*d.gramsPerCup*in.Max/in.Quantity)
+			}
+			lines[i] = in.Prefix + amount + " g " + in.Item
+			break
+		}
+	}
+	return template.HTML(strings.Join(lines, "\n"))
+}
+
+// formatGrams rounds a weight to the gram, or to a tenth of one when it is
+// small.
+func formatGrams(grams float64) string {
+	if grams < 10 {
+		return strconv.FormatFloat(math.Round(grams*10)/10, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(math.Round(grams), 'f', -1, 64)
+}
@@ -0,0 +1,162 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// MergePage is the confirmation page shown before two recipes are merged.
+type MergePage struct {
+	Title  string
+	Keep   *Page
+	From   *Page
+	Merged *Page
+	Theme  string
+}
+
+// A validTitle is a bare page filename as it appears in a URL.
+var validTitle = regexp.MustCompile("^" + filenamePattern + "$")
+
+// mergeHandler combines the recipe named by the from parameter into the recipe
+// named by keep.  A GET renders a preview of the result and a POST commits it.
+func mergeHandler(w http.ResponseWriter, r *http.Request) {
+	keep := r.FormValue("keep")
+	from := r.FormValue("from")
+	if !validTitle.MatchString(keep) || !validTitle.MatchString(from) || keep == from {
+		http.Error(w, "Both keep and from must name two different recipes.", http.StatusBadRequest)
+		return
+	}
+
+	// The merged recipe is saved whole over keep, so hold off other updates
+	// which could be lost in between.
+	if r.Method == "POST" {
+		updateMu.Lock()
+		defer updateMu.Unlock()
+	}
+
+	keepPage, err := loadPage(keep)
+	if err != nil {
+		notFound(w, r)
+		return
+	}
+	fromPage, err := loadPage(from)
+	if err != nil {
+		notFound(w, r)
+		return
+	}
+
+	merged := mergePages(keepPage, fromPage)
+
+	if r.Method != "POST" {
+		p := &MergePage{
+			Title:  "Merge " + fromPage.Title + " into " + keepPage.Title,
+			Keep:   keepPage,
+			From:   fromPage,
+			Merged: merged,
+			Theme:  chooseTheme(w, r)}
+
+		err := templates.ExecuteTemplate(w, "merge.html", p)
+		if err != nil {
+			serverError(w, r, err)
+		}
+		return
+	}
+
+	if err := snapshotPage(from); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if err := merged.save(); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if err := rewriteLinks(from, keep); err != nil {
+		serverError(w, r, err)
+		return
+	}
+	if err := store.Delete(from); err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	refreshIndex()
+	http.Redirect(w, r, basePath+"/view/"+keep, http.StatusFound)
+}
+
+// mergePages returns a copy of keep with the ingredients and instructions of
+// from appended under a subheading.  The prep and equipment of both are
+// combined, and the later of the dates they were last cooked is kept.
+func mergePages(keep, from *Page) *Page {
+	heading := "\n### From " + from.Title + "\n\n"
+
+	// The dates are YYYY-MM-DD, so they sort as strings.
+	lastCooked := keep.LastCooked
+	if from.LastCooked > lastCooked {
+		lastCooked = from.LastCooked
+	}
+
+	return &Page{
+		Title:        keep.Title,
+		Filename:     keep.Filename,
+		ID:           keep.ID,
+		Ingredients:  keep.Ingredients + template.HTML(heading) + from.Ingredients,
+		Instructions: keep.Instructions + template.HTML(heading) + from.Instructions,
+		Prep:         strings.Join(mergeTags(lineItems(keep.Prep), lineItems(from.Prep)), "\n"),
+		Equipment:    strings.Join(mergeTags(lineItems(keep.Equipment), lineItems(from.Equipment)), "\n"),
+		Servings:     keep.Servings,
+		Video:        keep.Video,
+		Source:       keep.Source,
+		Tags:         mergeTags(keep.Tags, from.Tags),
+		Flags:        mergeTags(keep.Flags, from.Flags),
+		Collection:   keep.Collection,
+		ForkedFrom:   keep.ForkedFrom,
+		MakeAgain:    keep.MakeAgain,
+		MadeCount:    keep.MadeCount + from.MadeCount,
+		LastCooked:   lastCooked,
+		Author:       keep.Author,
+		LastEditedBy: keep.LastEditedBy}
+}
+
+// rewriteLinks changes every wiki link to the page from, in every page, into a
+// link to the page to.  Links are resolved the way they are when rendered, so
+// a link to a recipe in a category is found by its name.  from must still be
+// in the index.
+func rewriteLinks(from, to string) error {
+	names, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	replacement := []byte("[[" + convertFilenameToTitle(to) + "]]")
+
+	for _, name := range names {
+		body, err := store.Load(name)
+		if err != nil {
+			return err
+		}
+
+		changed := false
+		body = wikiLink.ReplaceAllFunc(body, func(link []byte) []byte {
+			target := wikiLink.FindSubmatch(link)[1]
+			if resolveLink(convertTitleToFilename(string(target))) != from {
+				return link
+			}
+			changed = true
+			return replacement
+		})
+
+		if changed {
+			if err := store.Save(name, body); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMergePagesLastCooked(t *testing.T) {
+	tests := []struct {
+		keep, from, want string
+	}{
+		{"", "", ""},
+		{"2014-03-01", "", "2014-03-01"},
+		{"", "2014-03-01", "2014-03-01"},
+		{"2014-03-01", "2014-11-20", "2014-11-20"},
+		{"2014-11-20", "2014-03-01", "2014-11-20"},
+	}
+	for _, tt := range tests {
+		keep := &Page{Title: "Pie", LastCooked: tt.keep}
+		from := &Page{Title: "Tart", LastCooked: tt.from}
+		if got := mergePages(keep, from).LastCooked; got != tt.want {
+			t.Errorf("merging last cooked %q and %q = %q, want %q", tt.keep, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestMergePagesPrep(t *testing.T) {
+	keep := &Page{Title: "Pie", Prep: "Preheat the oven\nChill the butter\n"}
+	from := &Page{Title: "Tart", Prep: "Chill the butter\nZest the lemon\n"}
+
+	want := "Preheat the oven\nChill the butter\nZest the lemon"
+	if got := mergePages(keep, from).Prep; got != want {
+		t.Errorf("merged prep = %q, want %q", got, want)
+	}
+}
+
+// A merge waits for other updates to finish, so it can't save over them.
+func TestMergeWaitsForUpdates(t *testing.T) {
+	s := useMemStore(t)
+	s.Save("Apple-Pie", []byte(applePie))
+	s.Save("Pear-Tart", []byte("<!-- Title -->\nPear Tart\n<!-- Ingredients -->\n- 4 pears\n<!-- Instructions -->\nBake.\n"))
+	refreshIndex()
+
+	updateMu.Lock()
+	done := make(chan int)
+	go func() {
+		w := serve(mergeHandler, "POST", "/merge", url.Values{"keep": {"Apple-Pie"}, "from": {"Pear-Tart"}})
+		done <- w.Code
+	}()
+
+	var code int
+	select {
+	case code = <-done:
+		t.Error("the merge did not wait for the update in progress")
+		updateMu.Unlock()
+	case <-time.After(50 * time.Millisecond):
+		updateMu.Unlock()
+		code = <-done
+	}
+
+	if code != http.StatusFound {
+		t.Errorf("merge = %d, want 302", code)
+	}
+	if _, err := s.Load("Pear-Tart"); err == nil {
+		t.Error("the merged recipe was not removed")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// The small files of metadata kept beside the pages, such as the view counts
+// and the pinned recipes, are only read and written by a single goroutine.
+// Handlers queue a change for it rather than touching the files themselves,
+// so that concurrent requests cannot interleave their writes.
+
+// metaUpdate is a change queued for the metadata writer.  done is nil when
+// nobody waits for the change to be made.
+type metaUpdate struct {
+	apply func() error
+	done  chan error
+}
+
+// The length of the queue before queueing a change waits for the writer.
+const metaQueueLength = 256
+
+var (
+	metaOnce  sync.Once
+	metaQueue chan metaUpdate
+)
+
+// startMetaWriter starts the writer the first time it is needed.
+func startMetaWriter() {
+	metaOnce.Do(func() {
+		metaQueue = make(chan metaUpdate, metaQueueLength)
+		go runMetaWriter(metaQueue)
+	})
+}
+
+// runMetaWriter makes the queued changes one at a time, in the order they
+// were queued.
+func runMetaWriter(queue <-chan metaUpdate) {
+	for u := range queue {
+		err := u.apply()
+		if u.done != nil {
+			u.done <- err
+		} else if err != nil {
+			log.Printf("unable to update the metadata: %v", err)
+		}
+	}
+}
+
+// queueMeta queues a change to the metadata and returns without waiting for
+// it to be made.  An error is logged.
+func queueMeta(apply func() error) {
+	startMetaWriter()
+	metaQueue <- metaUpdate{apply: apply}
+}
+
+// withMeta queues a change to the metadata, or a read of it, and waits for it
+// to be made.
+func withMeta(apply func() error) error {
+	startMetaWriter()
+	done := make(chan error, 1)
+	metaQueue <- metaUpdate{apply: apply, done: done}
+	return <-done
+}
@@ -0,0 +1,105 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Views, pins and shopping list changes made at the same time all reach the
+// files, one after another.  Run with -race to check nothing else touches
+// them.
+func TestConcurrentMetaUpdates(t *testing.T) {
+	oldDir := pagesDir
+	pagesDir = t.TempDir()
+	var oldViews map[string]int
+	withMeta(func() error {
+		oldViews, views = views, make(map[string]int)
+		return nil
+	})
+	t.Cleanup(func() {
+		withMeta(func() error {
+			views, viewsDirty = oldViews, false
+			return nil
+		})
+		pagesDir = oldDir
+	})
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest("GET", "/view/Apple-Pie", nil)
+			r.Header.Set("User-Agent", "Mozilla/5.0")
+			countView(r, "Apple-Pie")
+		}()
+		go func(i int) {
+			defer wg.Done()
+			err := withMeta(func() error {
+				names, err := loadPinned()
+				if err != nil {
+					return err
+				}
+				names, _ = movePin(names, fmt.Sprintf("Recipe-%d", i), "add")
+				return savePinned(names)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			err := updateShoppingList(func(items []ShoppingItem) []ShoppingItem {
+				return append(items, ShoppingItem{Text: fmt.Sprintf("item %d", i)})
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var count int
+	var pinned []string
+	var items []ShoppingItem
+	err := withMeta(func() error {
+		count = views["Apple-Pie"]
+		if err := saveViews(); err != nil {
+			return err
+		}
+		views = make(map[string]int)
+		if err := loadViews(); err != nil {
+			return err
+		}
+		if views["Apple-Pie"] != count {
+			return fmt.Errorf("%d views were saved but %d read back", count, views["Apple-Pie"])
+		}
+
+		var err error
+		if pinned, err = loadPinned(); err != nil {
+			return err
+		}
+		items, err = readShoppingList()
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != n {
+		t.Errorf("counted %d views, want %d", count, n)
+	}
+	if len(pinned) != n {
+		t.Errorf("%d recipes are pinned, want %d", len(pinned), n)
+	}
+	if len(items) != n {
+		t.Errorf("the shopping list has %d items, want %d", len(items), n)
+	}
+}
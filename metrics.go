@@ -0,0 +1,75 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Counters reported by /metrics in the Prometheus text format.
+var (
+	requestsMu sync.Mutex
+	requests   = make(map[string]int64) // keyed by handler pattern
+
+	savesTotal   atomic.Int64
+	rendersTotal atomic.Int64
+)
+
+// countRequests counts each request against the pattern of the handler mux
+// routes it to.
+func countRequests(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			pattern = "none"
+		}
+
+		requestsMu.Lock()
+		requests[pattern]++
+		requestsMu.Unlock()
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// metricsHandler writes the counters, and the number of recipes, for
+// Prometheus to scrape.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	requestsMu.Lock()
+	patterns := make([]string, 0, len(requests))
+	for pattern := range requests {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	fmt.Fprintln(w, "# HELP recipewiki_requests_total Requests received, by handler.")
+	fmt.Fprintln(w, "# TYPE recipewiki_requests_total counter")
+	for _, pattern := range patterns {
+		fmt.Fprintf(w, "recipewiki_requests_total{handler=%q} %d\n", pattern, requests[pattern])
+	}
+	requestsMu.Unlock()
+
+	fmt.Fprintln(w, "# HELP recipewiki_saves_total Pages written to the store.")
+	fmt.Fprintln(w, "# TYPE recipewiki_saves_total counter")
+	fmt.Fprintf(w, "recipewiki_saves_total %d\n", savesTotal.Load())
+
+	fmt.Fprintln(w, "# HELP recipewiki_renders_total Pages rendered from markdown.")
+	fmt.Fprintln(w, "# TYPE recipewiki_renders_total counter")
+	fmt.Fprintf(w, "recipewiki_renders_total %d\n", rendersTotal.Load())
+
+	// The index always holds the home page as well as the recipes.
+	recipes := len(pages) - 1
+	if recipes < 0 {
+		recipes = 0
+	}
+	fmt.Fprintln(w, "# HELP recipewiki_recipes Recipes in the index.")
+	fmt.Fprintln(w, "# TYPE recipewiki_recipes gauge")
+	fmt.Fprintf(w, "recipewiki_recipes %d\n", recipes)
+}
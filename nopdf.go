@@ -0,0 +1,18 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !pdf
+
+package main
+
+import "net/http"
+
+// Without the pdf tag the wiki is built without the PDF library, and there
+// are no PDFs to download.
+const pdfExport = false
+
+// pdfHandler reports that PDFs are not available.
+func pdfHandler(w http.ResponseWriter, r *http.Request, title string) {
+	notFound(w, r)
+}
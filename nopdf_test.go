@@ -0,0 +1,31 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !pdf
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPDFWithoutTag(t *testing.T) {
+	s := useMemStore(t)
+	s.Save("Apple-Pie", []byte(applePie))
+	refreshIndex()
+
+	if w := serve(makeHandler(pdfHandler), "GET", "/pdf/Apple-Pie", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET /pdf/Apple-Pie = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	w := serve(makeHandler(viewHandler), "GET", "/view/Apple-Pie", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /view/Apple-Pie = %d, want %d", w.Code, http.StatusOK)
+	}
+	if strings.Contains(w.Body.String(), "/pdf/") {
+		t.Errorf("the view links to a PDF which cannot be made")
+	}
+}
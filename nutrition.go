@@ -0,0 +1,151 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"html/template"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// NutritionFacts are the estimated calories and grams of protein, fat and
+// carbohydrate in an amount of food.
+type NutritionFacts struct {
+	Calories float64
+	Protein  float64
+	Fat      float64
+	Carbs    float64
+}
+
+func (n NutritionFacts) add(m NutritionFacts, times float64) NutritionFacts {
+	return NutritionFacts{
+		Calories: n.Calories + m.Calories*times,
+		Protein:  n.Protein + m.Protein*times,
+		Fat:      n.Fat + m.Fat*times,
+		Carbs:    n.Carbs + m.Carbs*times}
+}
+
+// Nutrition is the estimated nutrition of a recipe.  Skipped lists the
+// ingredients which could not be estimated, making the estimate partial.
+type Nutrition struct {
+	Total      NutritionFacts
+	PerServing *NutritionFacts
+	Skipped    []string
+}
+
+// nutritionFood is one row of the nutrition table.
+type nutritionFood struct {
+	name  []string // the stemmed words of the name
+	unit  string
+	facts NutritionFacts
+}
+
+//go:embed data/nutrition.csv
+var nutritionData []byte
+
+// nutritionTable is parsed from nutritionData, longest names first so that
+// "brown sugar" is matched before "sugar".
+var nutritionTable = parseNutritionTable(nutritionData)
+
+func parseNutritionTable(data []byte) []nutritionFood {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	rows, err := r.ReadAll()
+	if err != nil {
+		log.Fatalf("unable to read the nutrition table: %v", err)
+	}
+
+	var table []nutritionFood
+	for _, row := range rows[1:] {
+		var values [4]float64
+		for i := range values {
+			values[i], err = strconv.ParseFloat(row[2+i], 64)
+			if err != nil {
+				log.Fatalf("unable to read the nutrition table: %v", err)
+			}
+		}
+
+		unit := ""
+		if row[1] != "" {
+			unit, _ = lookupUnit(row[1])
+		}
+
+		food := nutritionFood{
+			name:  words(row[0]),
+			unit:  unit,
+			facts: NutritionFacts{values[0], values[1], values[2], values[3]}}
+
+		// Keep longer names ahead of shorter ones.
+		i := len(table)
+		for i > 0 && len(table[i-1].name) < len(food.name) {
+			i--
+		}
+		table = append(table[:i], append([]nutritionFood{food}, table[i:]...)...)
+	}
+	return table
+}
+
+// lookupFood finds the row of the nutrition table for an ingredient name.
+func lookupFood(name string) (nutritionFood, bool) {
+	have := words(name)
+	for _, food := range nutritionTable {
+		if containsWords(have, food.name) {
+			return food, true
+		}
+	}
+	return nutritionFood{}, false
+}
+
+// containsWords reports whether want appears as a run of words within have.
+func containsWords(have, want []string) bool {
+	for i := 0; i+len(want) <= len(have); i++ {
+		if strings.Join(have[i:i+len(want)], " ") == strings.Join(want, " ") {
+			return true
+		}
+	}
+	return false
+}
+
+// estimateNutrition totals the nutrition of every ingredient which has a
+// quantity and is in the nutrition table.  The rest are reported as skipped.
+// When the recipe's servings are known the estimate per serving is included.
+func estimateNutrition(ingredients template.HTML, servings string) *Nutrition {
+	n := &Nutrition{}
+
+	for _, line := range ingredientLines(ingredients) {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		in, ok := parseIngredient(line)
+		if !ok {
+			n.Skipped = append(n.Skipped, plainText(line))
+			continue
+		}
+		food, ok := lookupFood(ingredientName(line))
+		if !ok {
+			n.Skipped = append(n.Skipped, plainText(line))
+			continue
+		}
+		amount, ok := convertQuantity(in.Quantity, in.Unit, food.unit)
+		if !ok {
+			n.Skipped = append(n.Skipped, plainText(line))
+			continue
+		}
+
+		n.Total = n.Total.add(food.facts, amount)
+	}
+
+	if count, ok := parseServings(servings); ok {
+		per := NutritionFacts{}.add(n.Total, 1/count)
+		n.PerServing = &per
+	}
+
+	return n
+}
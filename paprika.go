@@ -0,0 +1,170 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// paprikaRecipe holds the fields of a Paprika recipe export which the wiki
+// has a place for.  The rest are dropped.
+type paprikaRecipe struct {
+	Name        string   `json:"name"`
+	Ingredients string   `json:"ingredients"`
+	Directions  string   `json:"directions"`
+	Servings    string   `json:"servings"`
+	Source      string   `json:"source"`
+	SourceURL   string   `json:"source_url"`
+	Notes       string   `json:"notes"`
+	Categories  []string `json:"categories"`
+}
+
+// readPaprika reads the recipes from a Paprika export.  That may be a
+// .paprikarecipes archive of gzipped recipes, a single gzipped
+// .paprikarecipe, or plain JSON holding one recipe or a list of them.
+func readPaprika(data []byte) ([]paprikaRecipe, error) {
+	if z, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err == nil {
+		var recipes []paprikaRecipe
+		for _, f := range z.File {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			body, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+
+			found, err := readPaprika(body)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", f.Name, err)
+			}
+			recipes = append(recipes, found...)
+		}
+		return recipes, nil
+	}
+
+	if gz, err := gzip.NewReader(bytes.NewReader(data)); err == nil {
+		body, err := ioutil.ReadAll(gz)
+		if err != nil {
+			return nil, err
+		}
+		data = body
+	}
+
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var recipes []paprikaRecipe
+		err := json.Unmarshal(data, &recipes)
+		return recipes, err
+	}
+	var recipe paprikaRecipe
+	if err := json.Unmarshal(data, &recipe); err != nil {
+		return nil, err
+	}
+	return []paprikaRecipe{recipe}, nil
+}
+
+// paprikaPage turns a Paprika recipe into a page.  The source and notes,
+// which have no section of their own, go at the end of the instructions.
+func paprikaPage(recipe paprikaRecipe) *Page {
+	var ingredients []string
+	for _, line := range strings.Split(recipe.Ingredients, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			ingredients = append(ingredients, "* "+line)
+		}
+	}
+
+	var directions []string
+	for _, line := range strings.Split(recipe.Directions, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			directions = append(directions, line)
+		}
+	}
+	instructions := strings.Join(directions, "\n\n")
+
+	if recipe.Notes = strings.TrimSpace(recipe.Notes); recipe.Notes != "" {
+		instructions += "\n\n### Notes\n\n" + recipe.Notes
+	}
+	switch {
+	case recipe.SourceURL != "" && recipe.Source != "":
+		instructions += "\n\nSource: [" + recipe.Source + "](" + recipe.SourceURL + ")"
+	case recipe.SourceURL != "":
+		instructions += "\n\nSource: <" + recipe.SourceURL + ">"
+	case recipe.Source != "":
+		instructions += "\n\nSource: " + recipe.Source
+	}
+
+	return &Page{
+		Title:        strings.TrimSpace(recipe.Name),
+		Ingredients:  template.HTML(strings.Join(ingredients, "\n")),
+		Instructions: template.HTML(strings.TrimSpace(instructions)),
+		Servings:     strings.TrimSpace(recipe.Servings),
+		Tags:         parseTags(strings.Join(recipe.Categories, ","))}
+}
+
+// importPaprika saves every recipe in a Paprika export as a new page, then
+// updates the index once.  Recipes whose names collide with existing pages
+// get a numbered filename.  A summary of what was imported is written to out.
+func importPaprika(data []byte, out io.Writer) error {
+	recipes, err := readPaprika(data)
+	if err != nil {
+		return err
+	}
+
+	// The index is not updated until the end, so count the stored pages.
+	names, err := store.List()
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, name := range names {
+		if name != rootTitle {
+			count++
+		}
+	}
+
+	imported := 0
+	for _, recipe := range recipes {
+		p := paprikaPage(recipe)
+
+		filename := convertTitleToFilename(p.Title)
+		if filename == "" {
+			fmt.Fprintf(out, "skipped a recipe named %q\n", recipe.Name)
+			continue
+		}
+		// The pages are saved directly rather than through savePage, so
+		// that the index is only updated once, and must be checked the
+		// same way.
+		if section, ok := findSectionMarker(p); ok {
+			fmt.Fprintf(out, "skipped %s, whose %s has a section marker\n", p.Title, section)
+			continue
+		}
+		if maxRecipes > 0 && count >= maxRecipes {
+			fmt.Fprintf(out, "stopped at the limit of %d recipes\n", maxRecipes)
+			break
+		}
+		p.Filename = uniqueFilename(filename, "")
+
+		if err := p.save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "imported %s as %s\n", p.Title, p.Filename)
+		imported++
+		count++
+	}
+
+	fmt.Fprintf(out, "imported %d of %d recipes\n", imported, len(recipes))
+	return updateIndex()
+}
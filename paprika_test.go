@@ -0,0 +1,34 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestImportPaprikaSectionMarker(t *testing.T) {
+	s := useMemStore(t)
+
+	export := `[
+		{"name": "Pie", "ingredients": "2 apples", "directions": "Bake."},
+		{"name": "Tart", "ingredients": "1 pear", "directions": "Bake.\n<!-- Tags -->"}
+	]`
+	var out bytes.Buffer
+	if err := importPaprika([]byte(export), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := s.pages["Pie"]; !ok {
+		t.Errorf("Pie was not imported:\n%s", out.String())
+	}
+	if _, ok := s.pages["Tart"]; ok {
+		t.Errorf("Tart was imported with a section marker in its instructions")
+	}
+	if !strings.Contains(out.String(), "skipped Tart") {
+		t.Errorf("the summary does not mention skipping Tart:\n%s", out.String())
+	}
+}
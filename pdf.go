@@ -0,0 +1,107 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build pdf
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// pdfExport is whether recipes can be downloaded as PDFs, which needs the
+// wiki to be built with the pdf tag.
+const pdfExport = true
+
+// recipePDF lays a recipe out as a simple PDF recipe card: the title, then
+// the ingredients as a bulleted list and the instructions as numbered steps.
+// Headings within either section are set in bold.
+func recipePDF(p *Page) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "Letter", "")
+	pdf.SetTitle(p.Title, true)
+	pdf.SetMargins(20, 20, 20)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.AddPage()
+
+	// The core fonts only cover Windows-1252.
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.MultiCell(0, 10, tr(p.Title), "", "", false)
+	pdf.Ln(4)
+
+	heading := func(text string) {
+		pdf.SetFont("Helvetica", "B", 14)
+		pdf.MultiCell(0, 8, tr(text), "", "", false)
+		pdf.Ln(1)
+	}
+	item := func(marker, text string) {
+		pdf.SetFont("Helvetica", "", 11)
+		pdf.CellFormat(8, 6, marker, "", 0, "R", false, 0, "")
+		pdf.SetX(pdf.GetX() + 2)
+		pdf.MultiCell(0, 6, tr(text), "", "", false)
+	}
+	subheading := func(line string) {
+		pdf.Ln(2)
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.MultiCell(0, 6, tr(plainText(strings.TrimLeft(line, "# "))), "", "", false)
+	}
+
+	heading("Ingredients")
+	for _, line := range ingredientLines(p.Ingredients) {
+		if strings.HasPrefix(line, "#") {
+			subheading(line)
+			continue
+		}
+		if text := plainText(line); text != "" {
+			item(tr("•"), text)
+		}
+	}
+	pdf.Ln(6)
+
+	heading("Instructions")
+	step := 0
+	for _, line := range strings.Split(string(p.Instructions), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			subheading(line)
+			continue
+		}
+		if text := plainText(listMarker.ReplaceAllString(line, "")); text != "" {
+			step++
+			item(strconv.Itoa(step)+".", text)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfHandler sends a recipe as a PDF to be downloaded.
+func pdfHandler(w http.ResponseWriter, r *http.Request, title string) {
+	p, err := loadPage(title)
+	if err != nil {
+		notFound(w, r)
+		return
+	}
+
+	body, err := recipePDF(p)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+path.Base(p.Filename)+`.pdf"`)
+	w.Write(body)
+}
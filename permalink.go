@@ -0,0 +1,59 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Every recipe is given an ID the first time it is saved, kept in its ID
+// section.  Unlike its filename the ID never changes, so /r/<id> is a link to
+// the recipe which survives it being renamed.
+var validID = regexp.MustCompile("^[a-zA-Z0-9_-]{1,64}$")
+
+// The lower case letters and digits which IDs are made of.
+var idEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// newRecipeID returns a short random ID which no recipe in the index has.
+func newRecipeID() string {
+	for {
+		var b [5]byte
+		rand.Read(b[:])
+		id := idEncoding.EncodeToString(b[:])
+		if _, ok := lookupID(id); !ok {
+			return id
+		}
+	}
+}
+
+// lookupID returns the filename of the recipe with the ID.
+func lookupID(id string) (string, bool) {
+	for _, entry := range pages {
+		if entry.ID != "" && entry.ID == id {
+			return entry.Filename, true
+		}
+	}
+	return "", false
+}
+
+// permalinkHandler sends /r/<id> on to the recipe with the ID under its
+// current filename.
+func permalinkHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/r/")
+	if !validID.MatchString(id) {
+		notFound(w, r)
+		return
+	}
+	filename, ok := lookupID(id)
+	if !ok {
+		notFound(w, r)
+		return
+	}
+	http.Redirect(w, r, basePath+"/view/"+filename, http.StatusFound)
+}
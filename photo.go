@@ -0,0 +1,128 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif" // register the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Recipe photos are stored as resources/images/<filename>.jpg or .png.
+var imagesDir string = filepath.Join("resources", "images")
+
+// The largest photo, in bytes, which may be uploaded.
+var maxUploadSize int64 = 5 << 20
+
+// The largest width or height, in pixels, of a photo.  This guards against
+// small files which decode into enormous images.
+const maxImageDimension = 8000
+
+// The content types which may be uploaded and the extension each is stored
+// with once re-encoded.  SVG is deliberately absent since it can carry script.
+var uploadTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".png"}
+
+// photoURL returns the path of a recipe's photo, or "" if it has none.
+func photoURL(filename string) string {
+	for _, ext := range []string{".jpg", ".png"} {
+		if _, err := os.Stat(filepath.Join(imagesDir, filename+ext)); err == nil {
+			return "/resources/images/" + filename + ext
+		}
+	}
+	return ""
+}
+
+// uploadHandler attaches a photo to a recipe.  The upload must be a JPEG, PNG
+// or GIF no larger than maxUploadSize.  It is decoded and re-encoded so that
+// only the image itself, without metadata or trailing data, is stored.
+func uploadHandler(w http.ResponseWriter, r *http.Request, title string) {
+	if r.Method != "POST" {
+		http.Error(w, "Photos can only be uploaded with a POST.", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, err := loadPage(title); err != nil {
+		notFound(w, r)
+		return
+	}
+
+	// Allow some room for the rest of the multipart form.
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+64<<10)
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		http.Error(w, "A photo no larger than "+fmt.Sprint(maxUploadSize)+" bytes is required.", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(file, maxUploadSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > maxUploadSize {
+		http.Error(w, "The photo is larger than "+fmt.Sprint(maxUploadSize)+" bytes.", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	ext, ok := uploadTypes[http.DetectContentType(data)]
+	if !ok {
+		http.Error(w, "Only JPEG, PNG and GIF photos may be uploaded.", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width > maxImageDimension || config.Height > maxImageDimension {
+		http.Error(w, "The photo could not be read or is too large.", http.StatusBadRequest)
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, "The photo could not be read.", http.StatusBadRequest)
+		return
+	}
+
+	var out bytes.Buffer
+	if ext == ".jpg" {
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: 90})
+	} else {
+		err = png.Encode(&out, img)
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	photo, err := safePagePath(imagesDir, title, "")
+	if err != nil {
+		notFound(w, r)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(photo), dirMode); err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	// Replace any earlier photo, which may have the other extension.
+	for _, old := range []string{".jpg", ".png"} {
+		os.Remove(photo + old)
+	}
+	if err := ioutil.WriteFile(photo+ext, out.Bytes(), fileMode); err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, basePath+"/view/"+title, http.StatusFound)
+}
@@ -0,0 +1,125 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The pinned recipes are listed in order, one filename per line, in this file
+// in pagesDir.  They appear right after Home in the index.
+var pinnedFile string = ".pinned"
+
+// loadPinned returns the filenames of the pinned recipes in order.  It must be
+// run by the metadata writer.
+func loadPinned() ([]string, error) {
+	body, err := ioutil.ReadFile(filepath.Join(pagesDir, pinnedFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if name := strings.TrimSpace(line); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// savePinned writes out the filenames of the pinned recipes in order.  It
+// must be run by the metadata writer.
+func savePinned(names []string) error {
+	body := strings.Join(names, "\n") + "\n"
+	return ioutil.WriteFile(filepath.Join(pagesDir, pinnedFile), []byte(body), fileMode)
+}
+
+// isPinned reports whether the recipe is pinned in the index.
+func isPinned(filename string) bool {
+	for _, entry := range pages.Pinned() {
+		if entry.Filename == filename {
+			return true
+		}
+	}
+	return false
+}
+
+// pinHandler changes the pinned recipes.  The action parameter is one of add,
+// remove, up or down and applies to the recipe named by title.
+func pinHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Pins can only be changed with a POST.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	title := r.FormValue("title")
+	if !validTitle.MatchString(title) || title == rootTitle {
+		http.Error(w, "title must name a recipe.", http.StatusBadRequest)
+		return
+	}
+
+	action := r.FormValue("action")
+	if _, ok := movePin(nil, title, action); !ok {
+		http.Error(w, "action must be add, remove, up or down.", http.StatusBadRequest)
+		return
+	}
+
+	err := withMeta(func() error {
+		names, err := loadPinned()
+		if err != nil {
+			return err
+		}
+		names, _ = movePin(names, title, action)
+		return savePinned(names)
+	})
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	refreshIndex()
+	http.Redirect(w, r, basePath+"/view/"+title, http.StatusFound)
+}
+
+// movePin applies a pin action, one of add, remove, up or down, for the
+// recipe title to the pinned filenames.  It returns false if the action is
+// not one of those.
+func movePin(names []string, title, action string) ([]string, bool) {
+	i := -1
+	for n, name := range names {
+		if name == title {
+			i = n
+		}
+	}
+
+	switch action {
+	case "add":
+		if i < 0 {
+			names = append(names, title)
+		}
+	case "remove":
+		if i >= 0 {
+			names = append(names[:i], names[i+1:]...)
+		}
+	case "up":
+		if i > 0 {
+			names[i-1], names[i] = names[i], names[i-1]
+		}
+	case "down":
+		if i >= 0 && i < len(names)-1 {
+			names[i], names[i+1] = names[i+1], names[i]
+		}
+	default:
+		return names, false
+	}
+	return names, true
+}
@@ -0,0 +1,25 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "strings"
+
+// lineItems splits a section written one item per line, such as the tasks of
+// the Prep checklist or the Equipment list.  Each non-blank line is an item
+// and a leading list bullet is dropped, so the section may be written as a
+// markdown list or as plain lines.
+func lineItems(prep string) []string {
+	var items []string
+	for _, line := range strings.Split(prep, "\n") {
+		line = strings.TrimSpace(line)
+		for _, bullet := range []string{"- ", "* ", "+ "} {
+			line = strings.TrimPrefix(line, bullet)
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, line)
+		}
+	}
+	return items
+}
@@ -0,0 +1,142 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// When linkPreviews is set, bare links to other sites are shown with the
+// title of the page they point to.  Fetching titles means making requests
+// from the server, so it is off by default.
+var linkPreviews bool
+
+// previewClient fetches the pages to preview, giving up quickly so that a
+// slow site only delays a render a little.
+var previewClient = &http.Client{Timeout: 3 * time.Second}
+
+// How long fetched titles, and failures to fetch one, are remembered.
+const (
+	previewTTL        = 24 * time.Hour
+	previewFailureTTL = time.Hour
+)
+
+// previewEntry is a cached title.  An empty title records a failure.
+type previewEntry struct {
+	title   string
+	expires time.Time
+}
+
+var (
+	previewMu    sync.Mutex
+	previewCache = make(map[string]previewEntry)
+)
+
+// A bare link, which the markdown renderer makes from a URL in the text, and
+// the title of an html page.
+var bareLink = regexp.MustCompile(`<a href="(https?://[^"]+)">([^<]+)</a>`)
+var pageTitle = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// previewLinks replaces the text of bare external links in rendered html with
+// the titles of the pages they point to.  Links whose title can't be fetched
+// keep showing the URL.
+func previewLinks(text []byte) []byte {
+	var urls []string
+	for _, m := range bareLink.FindAllSubmatch(text, -1) {
+		if string(m[1]) == string(m[2]) {
+			urls = append(urls, html.UnescapeString(string(m[1])))
+		}
+	}
+	if len(urls) == 0 {
+		return text
+	}
+
+	titles := fetchTitles(urls)
+
+	return bareLink.ReplaceAllFunc(text, func(link []byte) []byte {
+		m := bareLink.FindSubmatch(link)
+		title := titles[html.UnescapeString(string(m[1]))]
+		if string(m[1]) != string(m[2]) || title == "" {
+			return link
+		}
+		return []byte(`<a href="` + string(m[1]) + `" title="` + string(m[1]) + `">` + html.EscapeString(title) + `</a>`)
+	})
+}
+
+// fetchTitles returns the titles of the pages at urls, from the cache or by
+// fetching them all at once.
+func fetchTitles(urls []string) map[string]string {
+	titles := make(map[string]string)
+	var missing []string
+
+	previewMu.Lock()
+	now := time.Now()
+	for _, url := range urls {
+		if e, ok := previewCache[url]; ok && now.Before(e.expires) {
+			titles[url] = e.title
+		} else {
+			missing = append(missing, url)
+		}
+	}
+	previewMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, url := range missing {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+
+			title := fetchTitle(url)
+			ttl := previewTTL
+			if title == "" {
+				ttl = previewFailureTTL
+			}
+
+			previewMu.Lock()
+			previewCache[url] = previewEntry{title: title, expires: time.Now().Add(ttl)}
+			titles[url] = title
+			previewMu.Unlock()
+		}(url)
+	}
+	wg.Wait()
+
+	return titles
+}
+
+// fetchTitle returns the title of the html page at url, or an empty string if
+// it can't be had.
+func fetchTitle(url string) string {
+	resp, err := previewClient.Get(url)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return ""
+	}
+
+	// The title is near the top, so don't read all of a large page.
+	head, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return ""
+	}
+	m := pageTitle.FindSubmatch(head)
+	if m == nil {
+		return ""
+	}
+
+	title := strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+	if r := []rune(title); len(r) > 100 {
+		title = strings.TrimSpace(string(r[:100])) + "…"
+	}
+	return title
+}
@@ -0,0 +1,35 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFetchTitleTruncatesWholeRunes(t *testing.T) {
+	// The hundredth byte falls inside an é.
+	long := "Crème " + strings.Repeat("crème brûlée ", 20)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<html><head><title>%s</title></head></html>", long)
+	}))
+	defer ts.Close()
+
+	title := fetchTitle(ts.URL)
+	if !utf8.ValidString(title) {
+		t.Fatalf("fetchTitle returned invalid UTF-8 %q", title)
+	}
+	if !strings.HasSuffix(title, "…") || utf8.RuneCountInString(title) > 101 {
+		t.Errorf("fetchTitle returned %q, want at most 100 runes and an ellipsis", title)
+	}
+	if !strings.HasPrefix(long, strings.TrimSuffix(title, "…")) {
+		t.Errorf("fetchTitle returned %q, want the start of the title", title)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// BinderPage is a printable book of recipes with a table of contents.
+type BinderPage struct {
+	Title   string
+	Recipes []*Page
+	Theme   string
+}
+
+// printbookHandler renders a set of recipes as one document to be printed,
+// each recipe starting a new page.  The only set is favorites, which are the
+// pinned recipes in the order they are pinned in the index.
+func printbookHandler(w http.ResponseWriter, r *http.Request) {
+	if strings.TrimPrefix(r.URL.Path, "/printbook/") != "favorites" {
+		notFound(w, r)
+		return
+	}
+
+	b := &BinderPage{
+		Title: "Favorite Recipes",
+		Theme: chooseTheme(w, r)}
+
+	for _, entry := range pages.Pinned() {
+		p, err := loadPage(entry.Filename)
+		if err != nil {
+			continue
+		}
+		// Collections only list other recipes, so they have nothing to print.
+		if p.Collection != "" {
+			continue
+		}
+		p.Truncated = truncatePage(p)
+		renderPage(p)
+		b.Recipes = append(b.Recipes, p)
+	}
+
+	err := templates.ExecuteTemplate(w, "printbook.html", b)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
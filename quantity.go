@@ -0,0 +1,417 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Ingredient is a single ingredient line split into its amount, unit and the
+// item itself.
+type Ingredient struct {
+	Prefix   string  // leading whitespace and list bullet
+	Amount   string  // the quantity as it was written
+	Quantity float64 // the quantity as a number, or the low end of a range
+	Max      float64 // the high end of a range like 2-3, or 0 if it is not one
+	Unit     string  // the canonical unit, or empty if there is none
+	UnitText string  // the unit as it was written
+	Item     string  // everything after the unit
+}
+
+// Values of the unicode vulgar fractions.
+var vulgarFractions = map[rune]float64{
+	'½': 1.0 / 2,
+	'⅓': 1.0 / 3,
+	'⅔': 2.0 / 3,
+	'¼': 1.0 / 4,
+	'¾': 3.0 / 4,
+	'⅛': 1.0 / 8,
+	'⅜': 3.0 / 8,
+	'⅝': 5.0 / 8,
+	'⅞': 7.0 / 8}
+
+// A quantity such as 2, 1.5, 1/2, 1 1/2, ½ or 1½.
+const quantityPattern = `\d+\s+\d+/\d+|\d+/\d+|\d*\.\d+|\d+\s*[½⅓⅔¼¾⅛⅜⅝⅞]|\d+|[½⅓⅔¼¾⅛⅜⅝⅞]`
+
+// An ingredient line starts with an optional bullet followed by a quantity or
+// a range of them, such as 2-3, 2–3 or 2 to 3.
+var ingredientPattern = regexp.MustCompile(`^(\s*(?:[-*+]\s+)?)` +
+	`((` + quantityPattern + `)(?:(?:\s*[-–—]\s*|\s+to\s+)(` + quantityPattern + `))?)` +
+	`\s*(.*)$`)
+
+// unitAliases maps the lower case spellings of each unit to its canonical
+// form.  The single letters t and T are case sensitive and handled separately.
+var unitAliases = map[string]string{
+	"tsp": "tsp", "tsp.": "tsp", "tsps": "tsp", "teaspoon": "tsp", "teaspoons": "tsp",
+	"tbsp": "tbsp", "tbsp.": "tbsp", "tbsps": "tbsp", "tbs": "tbsp", "tbs.": "tbsp",
+	"tablespoon": "tbsp", "tablespoons": "tbsp",
+	"c": "cup", "c.": "cup", "cup": "cup", "cups": "cup",
+	"fl oz": "fl oz", "fl. oz.": "fl oz", "fluid ounce": "fl oz", "fluid ounces": "fl oz",
+	"oz": "oz", "oz.": "oz", "ounce": "oz", "ounces": "oz",
+	"lb": "lb", "lb.": "lb", "lbs": "lb", "lbs.": "lb", "pound": "lb", "pounds": "lb",
+	"g": "g", "g.": "g", "gr": "g", "gram": "g", "grams": "g",
+	"kg": "kg", "kilogram": "kg", "kilograms": "kg",
+	"ml": "ml", "milliliter": "ml", "milliliters": "ml", "millilitre": "ml", "millilitres": "ml",
+	"l": "l", "liter": "l", "liters": "l", "litre": "l", "litres": "l",
+	"pt": "pt", "pint": "pt", "pints": "pt",
+	"qt": "qt", "quart": "qt", "quarts": "qt",
+	"gal": "gal", "gallon": "gal", "gallons": "gal",
+	"pinch": "pinch", "pinches": "pinch"}
+
+// parseIngredient splits an ingredient line into its parts.  It returns false
+// if the line does not start with a quantity.
+func parseIngredient(line string) (Ingredient, bool) {
+	m := ingredientPattern.FindStringSubmatch(line)
+	if m == nil {
+		return Ingredient{}, false
+	}
+
+	quantity, ok := parseQuantity(m[3])
+	if !ok {
+		return Ingredient{}, false
+	}
+
+	in := Ingredient{
+		Prefix:   m[1],
+		Amount:   m[2],
+		Quantity: quantity,
+		Item:     m[5]}
+
+	if m[4] != "" {
+		max, ok := parseQuantity(m[4])
+		switch {
+		case !ok:
+			return Ingredient{}, false
+		case max < 1 && !strings.ContainsAny(m[3], "/.½⅓⅔¼¾⅛⅜⅝⅞"):
+			// A mixed number written like 1-1/2.
+			in.Quantity += max
+		case max > quantity:
+			in.Max = max
+		default:
+			return Ingredient{}, false
+		}
+	}
+
+	// Try two word units like "fl oz" before single words.
+	words := strings.Fields(m[5])
+	for n := 2; n >= 1; n-- {
+		if len(words) < n {
+			continue
+		}
+		text := strings.Join(words[:n], " ")
+		if unit, ok := lookupUnit(text); ok {
+			in.Unit = unit
+			in.UnitText = text
+			in.Item = strings.Join(words[n:], " ")
+			break
+		}
+	}
+
+	return in, true
+}
+
+// ingredientList parses each ingredient line which starts with a quantity.
+func ingredientList(ingredients string) []Ingredient {
+	var list []Ingredient
+	for _, line := range strings.Split(ingredients, "\n") {
+		if in, ok := parseIngredient(strings.TrimSuffix(line, "\r")); ok {
+			list = append(list, in)
+		}
+	}
+	return list
+}
+
+// lookupUnit returns the canonical form of a unit.
+func lookupUnit(text string) (string, bool) {
+	switch text {
+	case "t":
+		return "tsp", true
+	case "T":
+		return "tbsp", true
+	}
+	unit, ok := unitAliases[strings.ToLower(text)]
+	return unit, ok
+}
+
+// parseQuantity converts a quantity such as 1 1/2 or 1½ into a number.
+func parseQuantity(amount string) (float64, bool) {
+	total := 0.0
+	for _, part := range strings.Fields(amount) {
+		if i := strings.Index(part, "/"); i >= 0 {
+			num, err1 := strconv.ParseFloat(part[:i], 64)
+			den, err2 := strconv.ParseFloat(part[i+1:], 64)
+			if err1 != nil || err2 != nil || den == 0 {
+				return 0, false
+			}
+			total += num / den
+			continue
+		}
+
+		digits := strings.TrimRightFunc(part, func(r rune) bool {
+			_, ok := vulgarFractions[r]
+			return ok
+		})
+		if digits != "" {
+			n, err := strconv.ParseFloat(digits, 64)
+			if err != nil {
+				return 0, false
+			}
+			total += n
+		}
+		for _, r := range part[len(digits):] {
+			total += vulgarFractions[r]
+		}
+	}
+	return total, true
+}
+
+// unitMeasure says what a canonical unit measures and how many of the base
+// unit of that measure, millilitres or grams, it holds.
+type unitMeasure struct {
+	volume bool
+	base   float64
+}
+
+var unitMeasures = map[string]unitMeasure{
+	"tsp":   {true, 4.92892},
+	"tbsp":  {true, 14.7868},
+	"cup":   {true, 236.588},
+	"fl oz": {true, 29.5735},
+	"ml":    {true, 1},
+	"l":     {true, 1000},
+	"pt":    {true, 473.176},
+	"qt":    {true, 946.353},
+	"gal":   {true, 3785.41},
+	"g":     {false, 1},
+	"kg":    {false, 1000},
+	"oz":    {false, 28.3495},
+	"lb":    {false, 453.592}}
+
+// convertQuantity converts a quantity between two canonical units.  It returns
+// false unless both units measure the same thing.  An empty unit, meaning a
+// count of whole items, only converts to itself.
+func convertQuantity(quantity float64, from, to string) (float64, bool) {
+	if from == to {
+		return quantity, true
+	}
+
+	f, ok1 := unitMeasures[from]
+	t, ok2 := unitMeasures[to]
+	if !ok1 || !ok2 || f.volume != t.volume {
+		return 0, false
+	}
+	return quantity * f.base / t.base, true
+}
+
+// unitLabel returns how a canonical unit is written for the given quantity.
+// Only cups are pluralised since the rest are abbreviations.
+func unitLabel(unit string, quantity float64) string {
+	if unit == "cup" && quantity != 1 {
+		return "cups"
+	}
+	return unit
+}
+
+// Fractions which quantities are shown with when they are close to one.
+var quantityFractions = []struct {
+	value float64
+	text  string
+}{
+	{1.0 / 8, "⅛"}, {1.0 / 4, "¼"}, {1.0 / 3, "⅓"}, {3.0 / 8, "⅜"},
+	{1.0 / 2, "½"}, {5.0 / 8, "⅝"}, {2.0 / 3, "⅔"}, {3.0 / 4, "¾"}, {7.0 / 8, "⅞"}}
+
+// formatQuantity writes a quantity the way a recipe would, as a whole number
+// and a common fraction like 1½ where it can, or else as a decimal.
+func formatQuantity(q float64) string {
+	whole := math.Floor(q)
+	rest := q - whole
+
+	if rest < 0.01 {
+		return strconv.FormatFloat(whole, 'f', -1, 64)
+	}
+	if rest > 0.99 {
+		return strconv.FormatFloat(whole+1, 'f', -1, 64)
+	}
+	for _, f := range quantityFractions {
+		if math.Abs(rest-f.value) < 0.01 {
+			if whole == 0 {
+				return f.text
+			}
+			return strconv.FormatFloat(whole, 'f', -1, 64) + f.text
+		}
+	}
+	return formatDecimal(q)
+}
+
+// formatDecimal writes a quantity as a decimal like 1.5, rounded to two
+// places.
+func formatDecimal(q float64) string {
+	return strconv.FormatFloat(math.Round(q*100)/100, 'f', -1, 64)
+}
+
+// quantityStyle is how the view shows quantities by default: "fraction",
+// "decimal", or empty to show them as they were written.
+var quantityStyle string
+
+// setQuantityStyle sets quantityStyle from the -quantities flag.
+func setQuantityStyle(style string) error {
+	switch style {
+	case "fraction", "decimal", "":
+		quantityStyle = style
+		return nil
+	}
+	return fmt.Errorf("%q is not fraction or decimal", style)
+}
+
+// chooseQuantityStyle returns the style asked for by the frac parameter, 1
+// for fractions and 0 for decimals, or else the default.
+func chooseQuantityStyle(r *http.Request) string {
+	switch r.FormValue("frac") {
+	case "1":
+		return "fraction"
+	case "0":
+		return "decimal"
+	}
+	return quantityStyle
+}
+
+// quantityFormatter returns the function which writes quantities in a style.
+// Quantities are written as fractions unless the style is decimal.
+func quantityFormatter(style string) func(float64) string {
+	if style == "decimal" {
+		return formatDecimal
+	}
+	return formatQuantity
+}
+
+// restyleQuantities rewrites the quantity at the start of each ingredient
+// line multiplied by factor and written with format, so that 1.5 cups can be
+// shown as 1½ cups or the other way around, or as the amount for one serving.
+// Lines without a quantity are left alone.
+func restyleQuantities(ingredients template.HTML, factor float64, format func(float64) string) template.HTML {
+	lines := strings.Split(string(ingredients), "\n")
+	for i, line := range lines {
+		in, ok := parseIngredient(strings.TrimSuffix(line, "\r"))
+		if !ok {
+			continue
+		}
+		rest := line[len(in.Prefix)+len(in.Amount):]
+		in.Quantity *= factor
+		in.Max *= factor
+		lines[i] = in.Prefix + in.formatAmount(format) + rest
+	}
+	return template.HTML(strings.Join(lines, "\n"))
+}
+
+// normalizeUnits rewrites the unit of every ingredient line in its canonical
+// spelling.  Lines without a recognised unit are left alone.
+func normalizeUnits(ingredients string) string {
+	lines := strings.Split(ingredients, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSuffix(line, "\r")
+		in, ok := parseIngredient(trimmed)
+		if !ok || in.Unit == "" {
+			continue
+		}
+
+		normalized := in.Prefix + in.Amount + " " + unitLabel(in.Unit, in.Quantity)
+		if in.Item != "" {
+			normalized += " " + in.Item
+		}
+		lines[i] = normalized + line[len(trimmed):]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ScaledIngredient is an ingredient line with its quantity scaled.  Lines
+// which have no quantity are kept as they are with Parsed set to false.
+type ScaledIngredient struct {
+	Ingredient
+	Line   string
+	Parsed bool
+}
+
+// scaleIngredients multiplies the quantity of every ingredient by factor.
+func scaleIngredients(lines []string, factor float64) []ScaledIngredient {
+	scaled := make([]ScaledIngredient, 0, len(lines))
+	for _, line := range lines {
+		in, ok := parseIngredient(line)
+		if ok {
+			in.Quantity *= factor
+			in.Max *= factor
+		}
+		scaled = append(scaled, ScaledIngredient{Ingredient: in, Line: line, Parsed: ok})
+	}
+	return scaled
+}
+
+// text writes the line again with its scaled amount written by format.
+func (s ScaledIngredient) text(format func(float64) string) string {
+	if !s.Parsed {
+		return s.Line
+	}
+	return s.Prefix + s.formatAmount(format) + s.Line[len(s.Prefix)+len(s.Amount):]
+}
+
+// FormatAmount writes the ingredient's quantity, or its range like 2–3, the
+// way formatQuantity does.
+func (in Ingredient) FormatAmount() string {
+	return in.formatAmount(formatQuantity)
+}
+
+// formatAmount writes the ingredient's quantity, or its range, with format.
+func (in Ingredient) formatAmount(format func(float64) string) string {
+	if in.Max == 0 {
+		return format(in.Quantity)
+	}
+	return format(in.Quantity) + "–" + format(in.Max)
+}
+
+// parseServings returns the number of servings at the start of a recipe's
+// yield, such as 4 from "4 people".  A range like "10-12 muffins" yields its
+// low end, so that scaling it scales both ends alike.
+func parseServings(servings string) (float64, bool) {
+	in, ok := parseIngredient(servings)
+	if !ok || in.Quantity <= 0 {
+		return 0, false
+	}
+	return in.Quantity, true
+}
+
+// A rendered list item, and the tags within one.
+var listItem = regexp.MustCompile(`(?s)<li>(.*?)</li>`)
+var anyTag = regexp.MustCompile(`<[^>]*>`)
+
+// annotateQuantities adds the parsed quantity and unit of each rendered
+// ingredient to its list item, as in <li data-qty="1.5" data-unit="cup">, so
+// that scripts in the page can scale the recipe.  Items which do not parse
+// are left as they are.
+func annotateQuantities(rendered []byte) []byte {
+	return listItem.ReplaceAllFunc(rendered, func(item []byte) []byte {
+		inner := listItem.FindSubmatch(item)[1]
+		text := html.UnescapeString(string(anyTag.ReplaceAll(inner, nil)))
+
+		in, ok := parseIngredient(strings.TrimSpace(text))
+		if !ok {
+			return item
+		}
+
+		attrs := fmt.Sprintf(` data-qty="%s"`, strconv.FormatFloat(in.Quantity, 'f', -1, 64))
+		if in.Max != 0 {
+			attrs += fmt.Sprintf(` data-qty-max="%s"`, strconv.FormatFloat(in.Max, 'f', -1, 64))
+		}
+		if in.Unit != "" {
+			attrs += fmt.Sprintf(` data-unit="%s"`, html.EscapeString(in.Unit))
+		}
+		return append([]byte("<li"+attrs+">"), item[len("<li>"):]...)
+	})
+}
@@ -0,0 +1,106 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestParseIngredientRanges(t *testing.T) {
+	tests := []struct {
+		line     string
+		quantity float64
+		max      float64
+		amount   string
+		unit     string
+		item     string
+	}{
+		{"2-3 cloves garlic", 2, 3, "2-3", "", "cloves garlic"},
+		{"2 - 3 cups flour", 2, 3, "2 - 3", "cup", "flour"},
+		{"2–3 cloves garlic", 2, 3, "2–3", "", "cloves garlic"},
+		{"- 2 – 3 tbsp butter", 2, 3, "2 – 3", "tbsp", "butter"},
+		{"2 to 3 cups stock", 2, 3, "2 to 3", "cup", "stock"},
+		{"1/2 to 3/4 cup milk", 0.5, 0.75, "1/2 to 3/4", "cup", "milk"},
+		{"1½–2 lb potatoes", 1.5, 2, "1½–2", "lb", "potatoes"},
+		// A hyphenated mixed number is one quantity, not a range.
+		{"1-1/2 cups sugar", 1.5, 0, "1-1/2", "cup", "sugar"},
+		{"3 eggs", 3, 0, "3", "", "eggs"},
+	}
+	for _, tt := range tests {
+		in, ok := parseIngredient(tt.line)
+		if !ok {
+			t.Errorf("parseIngredient(%q) did not parse", tt.line)
+			continue
+		}
+		if in.Quantity != tt.quantity || in.Max != tt.max || in.Amount != tt.amount || in.Unit != tt.unit || in.Item != tt.item {
+			t.Errorf("parseIngredient(%q) = %+v, want %v–%v %q %q %q",
+				tt.line, in, tt.quantity, tt.max, tt.amount, tt.unit, tt.item)
+		}
+	}
+
+	// A range which runs backwards is not read as one.
+	if in, ok := parseIngredient("3-2 cloves garlic"); ok {
+		t.Errorf("parseIngredient(%q) = %+v, want no match", "3-2 cloves garlic", in)
+	}
+}
+
+func TestScaleIngredientRanges(t *testing.T) {
+	tests := []struct {
+		line   string
+		factor float64
+		want   string
+	}{
+		{"2-3 cloves garlic", 2, "4–6"},
+		{"2–3 cloves garlic", 2, "4–6"},
+		{"2 to 3 cups stock", 0.5, "1–1½"},
+		{"1/2 to 3/4 cup milk", 2, "1–1½"},
+		{"1-1/2 cups sugar", 2, "3"},
+	}
+	for _, tt := range tests {
+		scaled := scaleIngredients([]string{tt.line}, tt.factor)
+		if len(scaled) != 1 || !scaled[0].Parsed {
+			t.Errorf("scaleIngredients(%q) did not parse", tt.line)
+			continue
+		}
+		if got := scaled[0].FormatAmount(); got != tt.want {
+			t.Errorf("%q times %v = %q, want %q", tt.line, tt.factor, got, tt.want)
+		}
+	}
+}
+
+func TestRestyleQuantityRanges(t *testing.T) {
+	tests := []struct {
+		ingredients string
+		want        string
+	}{
+		{"- 2-3 cloves garlic", "- 4–6 cloves garlic"},
+		{"- 2–3 cloves garlic", "- 4–6 cloves garlic"},
+		{"- 2 to 3 cups stock", "- 4–6 cups stock"},
+	}
+	for _, tt := range tests {
+		got := string(restyleQuantities(template.HTML(tt.ingredients), 2, formatQuantity))
+		if got != tt.want {
+			t.Errorf("restyleQuantities(%q) = %q, want %q", tt.ingredients, got, tt.want)
+		}
+	}
+}
+
+func TestParseServingsRange(t *testing.T) {
+	tests := []struct {
+		servings string
+		want     float64
+	}{
+		{"4", 4},
+		{"10-12 muffins", 10},
+		{"10–12 muffins", 10},
+		{"10 to 12 muffins", 10},
+	}
+	for _, tt := range tests {
+		if got, ok := parseServings(tt.servings); !ok || got != tt.want {
+			t.Errorf("parseServings(%q) = %v, %v, want %v", tt.servings, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// The cooking queue is a list of recipes to cook soon, kept only in a cookie
+// so that it lasts for the browser session and needs nothing on disk.
+const queueCookie = "queue"
+
+// The most recipes the queue holds, to keep the cookie small.
+const maxQueue = 50
+
+// QueuePage lists the recipes in the cooking queue.
+type QueuePage struct {
+	Title       string
+	Recipes     []IndexEntry
+	ShowList    bool
+	Ingredients []string // the combined shopping list, when ShowList is set
+	Theme       string
+	Index       Pages
+}
+
+// readQueue returns the filenames in the queue cookie.  Any which are not
+// valid filenames are dropped.
+func readQueue(r *http.Request) []string {
+	c, err := r.Cookie(queueCookie)
+	if err != nil {
+		return nil
+	}
+
+	var queue []string
+	for _, name := range strings.Split(c.Value, ":") {
+		if validTitle.MatchString(name) && len(queue) < maxQueue {
+			queue = append(queue, name)
+		}
+	}
+	return queue
+}
+
+// writeQueue stores the queue in its cookie, which lasts until the browser
+// is closed.
+func writeQueue(w http.ResponseWriter, queue []string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     queueCookie,
+		Value:    strings.Join(queue, ":"),
+		Path:     basePath + "/",
+		HttpOnly: true})
+}
+
+// queueHandler shows the cooking queue, and with the list parameter the
+// combined shopping list for it.  A POST with an action of add, remove or
+// clear changes the queue.
+func queueHandler(w http.ResponseWriter, r *http.Request) {
+	queue := readQueue(r)
+
+	if r.Method == "POST" {
+		recipe := r.FormValue("recipe")
+		redirect := basePath + "/queue"
+
+		switch r.FormValue("action") {
+		case "add":
+			if _, err := loadPage(recipe); !validTitle.MatchString(recipe) || err != nil {
+				http.Error(w, "no such recipe", http.StatusBadRequest)
+				return
+			}
+			if len(queue) >= maxQueue {
+				http.Error(w, "the queue is full", http.StatusBadRequest)
+				return
+			}
+			if !containsString(queue, recipe) {
+				queue = append(queue, recipe)
+			}
+			redirect = basePath + "/view/" + recipe
+		case "remove":
+			kept := queue[:0]
+			for _, name := range queue {
+				if name != recipe {
+					kept = append(kept, name)
+				}
+			}
+			queue = kept
+		case "clear":
+			queue = nil
+		default:
+			http.Error(w, "unknown action", http.StatusBadRequest)
+			return
+		}
+
+		writeQueue(w, queue)
+		http.Redirect(w, r, redirect, http.StatusFound)
+		return
+	}
+
+	q := &QueuePage{
+		Title:    "Cooking Queue",
+		ShowList: r.FormValue("list") != "",
+		Theme:    chooseTheme(w, r),
+		Index:    pages}
+
+	var recipes []*Page
+	for _, name := range queue {
+		p, err := loadPage(name)
+		if err != nil {
+			continue
+		}
+		recipes = append(recipes, p)
+		q.Recipes = append(q.Recipes, IndexEntry{Title: p.Title, Filename: p.Filename, Route: "view"})
+	}
+	if q.ShowList {
+		q.Ingredients = mergeIngredients(recipes)
+	}
+
+	err := templates.ExecuteTemplate(w, "queue.html", q)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// containsString reports whether s is one of list.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The most recipes /api/quickopen returns.
+const quickOpenLimit = 10
+
+// apiQuickOpenResult is a recipe whose title matches a quick open query.
+type apiQuickOpenResult struct {
+	Title    string `json:"title"`
+	Filename string `json:"filename"`
+	URL      string `json:"url"`
+}
+
+// fuzzyScore reports whether the letters of query appear in title in order,
+// ignoring case, and how closely they match.  Higher scores are closer:
+// letters which start the title, follow one another or start a word count for
+// more, and letters skipped over count against.
+func fuzzyScore(title, query string) (int, bool) {
+	t := []rune(strings.ToLower(title))
+	q := []rune(strings.ToLower(query))
+
+	score, last := 0, -1
+	for _, want := range q {
+		if unicode.IsSpace(want) {
+			continue
+		}
+		i := last + 1
+		for i < len(t) && t[i] != want {
+			i++
+		}
+		if i == len(t) {
+			return 0, false
+		}
+
+		switch {
+		case i == 0:
+			score += 10
+		case i == last+1 && last >= 0:
+			score += 8
+		case !unicode.IsLetter(t[i-1]) && !unicode.IsDigit(t[i-1]):
+			score += 6
+		default:
+			score -= i - last - 1
+		}
+		last = i
+	}
+	// Of two equally good matches the shorter title is the closer one.
+	return score*100 - len(t), true
+}
+
+// apiQuickOpenHandler returns the recipes whose titles fuzzy match the q
+// parameter, the closest first, for a client to offer as the query is typed.
+// Only the index in memory is searched, so it answers quickly.
+func apiQuickOpenHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.FormValue("q"))
+	results := []apiQuickOpenResult{}
+	if query == "" {
+		writeJSON(w, http.StatusOK, results)
+		return
+	}
+
+	type match struct {
+		entry IndexEntry
+		score int
+	}
+	var matches []match
+	for _, entry := range pages {
+		if score, ok := fuzzyScore(entry.Title, query); ok {
+			matches = append(matches, match{entry, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	for i, m := range matches {
+		if i == quickOpenLimit {
+			break
+		}
+		results = append(results, apiQuickOpenResult{
+			Title:    m.entry.Title,
+			Filename: m.entry.Filename,
+			URL:      basePath + "/" + m.entry.Route + "/" + m.entry.Filename})
+	}
+	writeJSON(w, http.StatusOK, results)
+}
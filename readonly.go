@@ -0,0 +1,36 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "net/http"
+
+// When readOnly is set the wiki can be browsed but not changed.  The routes
+// which change anything are refused and the templates leave out the links
+// and forms which lead to them.
+var readOnly bool
+
+// writable wraps a handler which changes the wiki so that it is refused in
+// read-only mode.
+func writable(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if readOnly {
+			http.Error(w, "This wiki is read-only.", http.StatusForbidden)
+			return
+		}
+		fn(w, r)
+	}
+}
+
+// readOnlyGET wraps a handler which shows something on a GET and changes it
+// on a POST, so that only the POST is refused in read-only mode.
+func readOnlyGET(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if readOnly && r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, "This wiki is read-only.", http.StatusForbidden)
+			return
+		}
+		fn(w, r)
+	}
+}
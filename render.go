@@ -0,0 +1,24 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/russross/blackfriday"
+)
+
+// A Renderer converts the markdown in a page into html.
+type Renderer interface {
+	Render(markdown []byte) []byte
+}
+
+// blackfridayRenderer renders markdown with blackfriday's common extensions.
+type blackfridayRenderer struct{}
+
+func (blackfridayRenderer) Render(markdown []byte) []byte {
+	return blackfriday.MarkdownCommon(markdown)
+}
+
+// renderer is used to render the markdown of every page.
+var renderer Renderer = blackfridayRenderer{}
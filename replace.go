@@ -0,0 +1,205 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ReplacePage reports the recipes affected by a find and replace.
+type ReplacePage struct {
+	Title   string
+	Find    string
+	Replace string
+	Regexp  bool
+	Key     string // the API key, passed on to the confirmation
+	NeedKey bool
+	DryRun  bool
+	Stale   bool   // the recipes changed after the dry run it confirms
+	Confirm string // identifies the dry run, to be sent back to confirm it
+	Changes []ReplaceChange
+	Theme   string
+}
+
+// ReplaceChange is a recipe changed by a find and replace.
+type ReplaceChange struct {
+	Title    string
+	Filename string
+	Lines    int // the number of lines changed
+}
+
+// replaceLines applies replace to every line of a stored page except the
+// section markers, so that the sections themselves stay intact.  It returns
+// the new contents and how many lines changed.
+func replaceLines(body string, replace func(string) string) (string, int) {
+	lines := strings.Split(body, "\n")
+	changed := 0
+	for i, line := range lines {
+		if _, ok := sectionMarker(line); ok {
+			continue
+		}
+		if after := replace(line); after != line {
+			lines[i] = after
+			changed++
+		}
+	}
+	return strings.Join(lines, "\n"), changed
+}
+
+// sameSections reports whether two versions of a stored page have the same
+// section markers, and the second leaves no comment open which the first did
+// not, so that a replacement has only changed the text of the sections.
+func sameSections(before, after string) bool {
+	markers := func(body string) []string {
+		var names []string
+		for _, line := range strings.Split(body, "\n") {
+			if name, ok := sectionMarker(line); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+
+	a, b := markers(before), markers(after)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return unclosedComment(before) || !unclosedComment(after)
+}
+
+// replaceHandler finds text in every recipe and replaces it, literally or as
+// a regular expression when regexp is set.  Without a find parameter it shows
+// the form.  Otherwise it makes a dry run, listing the recipes and lines that
+// would change, and only a POST which sends back the confirm value of that
+// dry run makes the change.  If the recipes changed after the dry run it is
+// run again instead.  Each recipe is snapshotted before it is changed.
+//
+// When an API key is configured it must be sent, in the X-API-Key header or
+// the key field of a POST body.  A key in the URL is ignored, since it would
+// be kept in logs and the browser's history.
+func replaceHandler(w http.ResponseWriter, r *http.Request) {
+	rp := &ReplacePage{
+		Title:   "Find and Replace",
+		Find:    r.FormValue("find"),
+		Replace: r.FormValue("replace"),
+		Regexp:  r.FormValue("regexp") != "",
+		Key:     r.PostFormValue("key"),
+		NeedKey: apiKey != "",
+		DryRun:  true,
+		Theme:   chooseTheme(w, r)}
+
+	if rp.Key == "" {
+		rp.Key = r.Header.Get("X-API-Key")
+	}
+	if apiKey != "" && rp.Find != "" && subtle.ConstantTimeCompare([]byte(rp.Key), []byte(apiKey)) != 1 {
+		http.Error(w, "A valid API key is required.", http.StatusUnauthorized)
+		return
+	}
+
+	if rp.Find == "" {
+		renderReplace(w, r, rp)
+		return
+	}
+	// A replacement must stay on its line and must not open or close a
+	// comment, or it could add a section or hide the ones after it.
+	if strings.Contains(rp.Replace, "\n") || hasCommentMarkup(rp.Replace) {
+		http.Error(w, "replace must be a single line without html comments.", http.StatusBadRequest)
+		return
+	}
+
+	replace := func(s string) string { return strings.Replace(s, rp.Find, rp.Replace, -1) }
+	if rp.Regexp {
+		pattern, err := regexp.Compile(rp.Find)
+		if err != nil {
+			http.Error(w, "find is not a valid regular expression: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		replace = func(s string) string { return pattern.ReplaceAllString(s, rp.Replace) }
+	}
+
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	// The confirm value covers the request and the current contents of each
+	// recipe it changes, so a confirmation only applies to what was shown.
+	type update struct {
+		filename string
+		body     string
+	}
+	var updates []update
+	hash := sha256.New()
+	hash.Write([]byte(rp.Find + "\x00" + rp.Replace + "\x00"))
+	if rp.Regexp {
+		hash.Write([]byte("regexp\x00"))
+	}
+
+	for _, entry := range pages[1:] {
+		body, err := store.Load(entry.Filename)
+		if err != nil {
+			continue
+		}
+		after, lines := replaceLines(string(body), replace)
+		if lines == 0 {
+			continue
+		}
+		// A regular expression can still piece markup together from the
+		// text around a match.
+		if !sameSections(string(body), after) {
+			http.Error(w, "The replacement would change the sections of "+entry.Title+".", http.StatusBadRequest)
+			return
+		}
+
+		hash.Write([]byte(entry.Filename + "\x00"))
+		hash.Write(body)
+		updates = append(updates, update{entry.Filename, after})
+		rp.Changes = append(rp.Changes, ReplaceChange{
+			Title:    entry.Title,
+			Filename: entry.Filename,
+			Lines:    lines})
+	}
+	rp.Confirm = hex.EncodeToString(hash.Sum(nil))
+
+	if r.Method == "POST" && r.FormValue("confirm") != "" {
+		if r.FormValue("confirm") != rp.Confirm {
+			rp.Stale = true
+		} else {
+			rp.DryRun = false
+		}
+	}
+
+	if !rp.DryRun {
+		for _, u := range updates {
+			if err := snapshotPage(u.filename); err != nil {
+				serverError(w, r, err)
+				return
+			}
+			savesTotal.Add(1)
+			if err := store.Save(u.filename, []byte(u.body)); err != nil {
+				serverError(w, r, err)
+				return
+			}
+		}
+		refreshIndex()
+	}
+
+	renderReplace(w, r, rp)
+}
+
+func renderReplace(w http.ResponseWriter, r *http.Request, rp *ReplacePage) {
+	err := templates.ExecuteTemplate(w, "replace.html", rp)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
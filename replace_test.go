@@ -0,0 +1,37 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestReplaceKeepsSections(t *testing.T) {
+	s := useMemStore(t)
+	const tip = "<!-- Title -->\nApple Pie\n<!-- Instructions -->\nBake.\nTip: < !-- ID -->\n<!-- ID -->\nabc\n"
+	s.Save("Apple-Pie", []byte(tip))
+	refreshIndex()
+
+	tests := []url.Values{
+		{"find": {"Bake."}, "replace": {"Bake.\n<!-- ID -->\nhijack"}},
+		{"find": {"Bake."}, "replace": {"Bake. <!-- later"}},
+		{"find": {"^Tip: < "}, "replace": {"<"}, "regexp": {"on"}},
+	}
+	for _, form := range tests {
+		w := serve(replaceHandler, "POST", "/replace", form)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("replacing %q with %q = %d, want 400", form.Get("find"), form.Get("replace"), w.Code)
+		}
+	}
+
+	if body, _ := s.Load("Apple-Pie"); string(body) != tip {
+		t.Errorf("the page was changed:\n%s", body)
+	}
+	if p, err := loadPage("Apple-Pie"); err != nil || p.ID != "abc" {
+		t.Errorf("the page's ID = %q, %v, want abc", p.ID, err)
+	}
+}
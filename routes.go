@@ -0,0 +1,92 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "net/http"
+
+// routeSet chooses which routes a listener serves.
+type routeSet int
+
+const (
+	// allRoutes is the whole wiki: the pages, the forms which change them and
+	// the API.
+	allRoutes routeSet = iota
+
+	// readAPIRoutes is only the parts of the JSON API which read recipes, for
+	// a listener exposed where nothing should be edited.  The routes which
+	// also have an html page only answer in JSON.
+	readAPIRoutes
+)
+
+// newMux registers the handlers of a set of routes on a new mux.
+func newMux(routes routeSet) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/recipe/", allowCORS(makeAPIHandler(apiRecipeHandler)))
+	mux.HandleFunc("/api/scaled/", allowCORS(makeAPIHandler(apiScaledHandler)))
+	mux.HandleFunc("/api/validate", allowCORS(apiValidateHandler))
+	mux.HandleFunc("/api/quickopen", allowCORS(apiQuickOpenHandler))
+	mux.HandleFunc("/api/history/", allowCORS(apiHistoryHandler))
+	if routes == readAPIRoutes {
+		mux.HandleFunc("/view/", allowCORS(makeAPIHandler(apiRecipeHandler)))
+		mux.HandleFunc("/substitute/", allowCORS(jsonOnly(substituteHandler)))
+		return mux
+	}
+
+	mux.HandleFunc("/", indexHandler)
+	mux.HandleFunc("/view/", makeHandler(viewHandler))
+	mux.HandleFunc("/r/", permalinkHandler)
+	mux.HandleFunc("/edit/", writable(makeHandler(editHandler)))
+	mux.HandleFunc("/save/", writable(saveRoute))
+	mux.HandleFunc("/menu/", makeHandler(menuHandler))
+	mux.HandleFunc("/api/save/", allowCORS(writable(requireAPIKey(makeAPIHandler(apiSaveHandler)))))
+	mux.HandleFunc("/api/reorder/", allowCORS(writable(requireAPIKey(apiReorderHandler))))
+	mux.HandleFunc("/live-preview", writable(livePreviewHandler))
+	mux.HandleFunc("/reindex", requireAPIKey(reindexHandler))
+	mux.HandleFunc("/raw/", makeHandler(rawHandler))
+	mux.HandleFunc("/text/ingredients/", makeHandler(textIngredientsHandler))
+	mux.HandleFunc("/pdf/", makeHandler(pdfHandler))
+	mux.HandleFunc("/fork/", writable(makeHandler(forkHandler)))
+	mux.HandleFunc("/forks/", makeHandler(forksHandler))
+	mux.HandleFunc("/madeitagain/", writable(makeHandler(madeItAgainHandler)))
+	mux.HandleFunc("/cooked/", writable(makeHandler(cookedHandler)))
+	mux.HandleFunc("/cooked", leastRecentlyCookedHandler)
+	mux.HandleFunc("/flag/", writable(makeHandler(flagHandler)))
+	mux.HandleFunc("/flagged/", flaggedHandler)
+	mux.HandleFunc("/popular", popularHandler)
+	mux.HandleFunc("/stats", statsHandler)
+	mux.HandleFunc("/today", todayHandler)
+	mux.HandleFunc("/merge", writable(mergeHandler))
+	mux.HandleFunc("/retag", writable(retagHandler))
+	mux.HandleFunc("/autotag", writable(autotagHandler))
+	mux.HandleFunc("/replace", writable(replaceHandler))
+	mux.HandleFunc("/pin", writable(pinHandler))
+	mux.HandleFunc("/mealplan", readOnlyGET(mealPlanHandler))
+	mux.HandleFunc("/list", readOnlyGET(shoppingListHandler))
+	mux.HandleFunc("/queue", queueHandler)
+	mux.HandleFunc("/printbook/", printbookHandler)
+	mux.HandleFunc("/substitute/", substituteHandler)
+	mux.HandleFunc("/safe", safeHandler)
+	mux.HandleFunc("/upload/", writable(makeHandler(uploadHandler)))
+	mux.HandleFunc("/import", writable(importHandler))
+	mux.HandleFunc("/search", searchHandler)
+	mux.HandleFunc("/duplicates", duplicatesHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/uses/", makeHandler(usesHandler))
+	mux.Handle("/resources/", http.StripPrefix("/resources/", http.FileServer(http.Dir("resources"))))
+	return mux
+}
+
+// serveMux logs and counts the requests to mux.  Requests under the base path
+// are routed as if it were the root.
+func serveMux(mux *http.ServeMux) http.Handler {
+	handler := logRequests(countRequests(mux))
+	if basePath != "" {
+		prefixed := http.NewServeMux()
+		prefixed.Handle(basePath+"/", http.StripPrefix(basePath, handler))
+		handler = prefixed
+	}
+	return handler
+}
@@ -0,0 +1,75 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Scaffolds are skeleton recipes which a new page can start from.  They live
+// in the recipes directory under templateDir and, like the templates, fall
+// back to the built-in copies.
+const scaffoldDir = "recipes"
+
+// loadScaffold reads the named scaffold into a page with no title.
+func loadScaffold(name string) (*Page, error) {
+	if !validTitle.MatchString(name) {
+		return nil, os.ErrNotExist
+	}
+
+	body, err := ioutil.ReadFile(filepath.Join(templateDir, scaffoldDir, name+".txt"))
+	if os.IsNotExist(err) {
+		body, err = defaultTemplates.ReadFile(path.Join("templates", scaffoldDir, name+".txt"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sections, err := parseRecipe(body)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Page{
+		Ingredients:  template.HTML(sections["Ingredients"]),
+		Instructions: template.HTML(sections["Instructions"]),
+		Prep:         strings.TrimSpace(sections["Prep"]),
+		Equipment:    strings.TrimSpace(sections["Equipment"]),
+		Servings:     strings.TrimSpace(sections["Servings"])}
+
+	return p, nil
+}
+
+// scaffoldNames lists the scaffolds which are available, built-in or not.
+func scaffoldNames() []string {
+	seen := make(map[string]bool)
+
+	if files, err := defaultTemplates.ReadDir(path.Join("templates", scaffoldDir)); err == nil {
+		for _, f := range files {
+			seen[strings.TrimSuffix(f.Name(), ".txt")] = true
+		}
+	}
+	if files, err := ioutil.ReadDir(filepath.Join(templateDir, scaffoldDir)); err == nil {
+		for _, f := range files {
+			if strings.HasSuffix(f.Name(), ".txt") {
+				seen[strings.TrimSuffix(f.Name(), ".txt")] = true
+			}
+		}
+	}
+
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,194 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SearchResult is a page which matched a search along with an excerpt of the
+// text around the first match.
+type SearchResult struct {
+	Title    string
+	Filename string
+	Excerpt  template.HTML
+}
+
+// SearchPage lists the results of a search.
+type SearchPage struct {
+	Title    string
+	Filename string
+	Query    string
+	Results  []SearchResult
+	Theme    string
+	Index    Pages
+}
+
+// The number of bytes of context shown on either side of a match.
+const excerptRadius = 60
+
+// searchHandler finds every page whose title, ingredients or instructions
+// contain the query, ignoring case.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.FormValue("q"))
+
+	s := &SearchPage{
+		Title: "Search",
+		Query: query,
+		Theme: chooseTheme(w, r),
+		Index: pages}
+
+	if query != "" {
+		s.Title = "Search for " + query
+		pattern := regexp.MustCompile("(?i)" + regexp.QuoteMeta(query))
+
+		for _, entry := range pages[1:] {
+			p, err := loadPage(entry.Filename)
+			if err != nil {
+				continue
+			}
+
+			text := string(p.Ingredients) + "\n" + string(p.Instructions)
+			excerpt, ok := highlightExcerpt(text, pattern)
+			if !ok && !pattern.MatchString(p.Title) {
+				continue
+			}
+
+			s.Results = append(s.Results, SearchResult{
+				Title:    p.Title,
+				Filename: p.Filename,
+				Excerpt:  excerpt})
+		}
+	}
+
+	err := templates.ExecuteTemplate(w, "search.html", s)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// highlightExcerpt returns the raw text surrounding the first match of
+// pattern, trimmed to whole words, with the match wrapped in <mark>.  All other
+// text is escaped so the highlight is the only markup in the excerpt.
+func highlightExcerpt(text string, pattern *regexp.Regexp) (template.HTML, bool) {
+	loc := pattern.FindStringIndex(text)
+	if loc == nil {
+		return "", false
+	}
+
+	start := loc[0] - excerptRadius
+	if start <= 0 {
+		start = 0
+	} else {
+		// Skip ahead past the partial word we landed in.
+		if i := strings.IndexFunc(text[start:loc[0]], unicode.IsSpace); i >= 0 {
+			start += i
+		} else {
+			start = loc[0]
+		}
+	}
+
+	end := loc[1] + excerptRadius
+	if end >= len(text) {
+		end = len(text)
+	} else {
+		// Back up to the end of the last whole word.
+		if i := strings.LastIndexFunc(text[loc[1]:end], unicode.IsSpace); i >= 0 {
+			end = loc[1] + i
+		} else {
+			end = loc[1]
+		}
+	}
+
+	before := strings.Join(strings.Fields(text[start:loc[0]]), " ")
+	match := text[loc[0]:loc[1]]
+	after := strings.Join(strings.Fields(text[loc[1]:end]), " ")
+
+	// Keep the spacing around the match which Fields removed.
+	if r, _ := utf8.DecodeLastRuneInString(text[:loc[0]]); before != "" && unicode.IsSpace(r) {
+		before += " "
+	}
+	if r, _ := utf8.DecodeRuneInString(text[loc[1]:]); after != "" && unicode.IsSpace(r) {
+		after = " " + after
+	}
+
+	excerpt := template.HTMLEscapeString(before) +
+		"<mark>" + template.HTMLEscapeString(match) + "</mark>" +
+		template.HTMLEscapeString(after)
+	if start > 0 {
+		excerpt = "&hellip;" + excerpt
+	}
+	if end < len(text) {
+		excerpt += "&hellip;"
+	}
+
+	return template.HTML(excerpt), true
+}
+
+// usesHandler lists the recipes which use an ingredient.  Ingredient names are
+// compared without their quantity and unit, matching any name containing the
+// ingredient unless the exact parameter is set.
+func usesHandler(w http.ResponseWriter, r *http.Request, ingredient string) {
+	want := normalizeIngredientName(ingredient)
+	exact := r.FormValue("exact") != ""
+
+	s := &SearchPage{
+		Title: "Recipes using " + want,
+		Query: want,
+		Theme: chooseTheme(w, r),
+		Index: pages}
+
+	for _, entry := range pages[1:] {
+		p, err := loadPage(entry.Filename)
+		if err != nil {
+			continue
+		}
+
+		var matches []string
+		for _, line := range ingredientLines(p.Ingredients) {
+			name := ingredientName(line)
+			if name == want || (!exact && strings.Contains(name, want)) {
+				matches = append(matches, line)
+			}
+		}
+
+		if len(matches) > 0 {
+			s.Results = append(s.Results, SearchResult{
+				Title:    p.Title,
+				Filename: p.Filename,
+				Excerpt:  template.HTML(template.HTMLEscapeString(strings.Join(matches, "; ")))})
+		}
+	}
+
+	err := templates.ExecuteTemplate(w, "search.html", s)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
+
+// ingredientName returns the name of the ingredient on a line, without its
+// quantity, unit or any preparation notes after a comma.
+func ingredientName(line string) string {
+	if in, ok := parseIngredient(line); ok {
+		line = in.Item
+	}
+	if i := strings.IndexAny(line, ",("); i >= 0 {
+		line = line[:i]
+	}
+	return normalizeIngredientName(line)
+}
+
+// normalizeIngredientName lower cases a name and removes markdown emphasis and
+// hyphens so that names can be compared.
+func normalizeIngredientName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.NewReplacer("-", " ", "*", "", "_", "", "`", "").Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}
@@ -0,0 +1,32 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"regexp"
+	"testing"
+)
+
+func TestHighlightExcerpt(t *testing.T) {
+	tests := []struct {
+		text, pattern string
+		want          template.HTML
+	}{
+		{"apple pie crust", "pie", "apple <mark>pie</mark> crust"},
+		{"apple\u2003pie\u2003crust", "pie", "apple <mark>pie</mark> crust"},
+		{"pie crust", "pie", "<mark>pie</mark> crust"},
+		// The last byte of Å is 0x85, which is a space as a rune alone.
+		{"Åpie crust", "pie", "Å<mark>pie</mark> crust"},
+		{"crème brûlée", "brûlée", "crème <mark>brûlée</mark>"},
+		{"<b>pie</b>", "pie", "&lt;b&gt;<mark>pie</mark>&lt;/b&gt;"},
+	}
+	for _, tt := range tests {
+		got, ok := highlightExcerpt(tt.text, regexp.MustCompile(tt.pattern))
+		if !ok || got != tt.want {
+			t.Errorf("highlightExcerpt(%q, %q) = %q, %v, want %q", tt.text, tt.pattern, got, ok, tt.want)
+		}
+	}
+}
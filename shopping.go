@@ -0,0 +1,45 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"strings"
+)
+
+// ingredientLines splits an ingredients section into its individual lines,
+// dropping blank lines and any markdown list bullets.
+func ingredientLines(ingredients template.HTML) []string {
+	var lines []string
+	for _, line := range strings.Split(string(ingredients), "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimLeft(line, "*-+ ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// mergeIngredients combines the ingredients of several recipes into a single
+// shopping list.  Lines which are the same apart from case are only listed
+// once and the order of first appearance is kept.
+func mergeIngredients(recipes []*Page) []string {
+	var merged []string
+	seen := make(map[string]bool)
+
+	for _, p := range recipes {
+		for _, line := range ingredientLines(p.Ingredients) {
+			key := strings.ToLower(line)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged = append(merged, line)
+		}
+	}
+
+	return merged
+}
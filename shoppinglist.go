@@ -0,0 +1,215 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The persistent shopping list is kept in this file in pagesDir with one item
+// per line, each starting with "[ ] " or, once it is bought, "[x] ".
+var shoppingListFile string = ".shoppinglist"
+
+// ShoppingItem is one line of the shopping list.
+type ShoppingItem struct {
+	Text    string
+	Checked bool
+}
+
+// ShoppingListPage shows the persistent shopping list.
+type ShoppingListPage struct {
+	Title string
+	Items []ShoppingItem
+	Theme string
+	Index Pages
+}
+
+// readShoppingList reads the list.  It must be run by the metadata writer.
+func readShoppingList() ([]ShoppingItem, error) {
+	body, err := ioutil.ReadFile(filepath.Join(pagesDir, shoppingListFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var items []ShoppingItem
+	for _, line := range strings.Split(string(body), "\n") {
+		switch {
+		case strings.HasPrefix(line, "[x] "):
+			items = append(items, ShoppingItem{Text: line[4:], Checked: true})
+		case strings.HasPrefix(line, "[ ] "):
+			items = append(items, ShoppingItem{Text: line[4:]})
+		case strings.TrimSpace(line) != "":
+			items = append(items, ShoppingItem{Text: strings.TrimSpace(line)})
+		}
+	}
+	return items, nil
+}
+
+// updateShoppingList reads the list, lets change modify it and writes it back,
+// all in one change made by the metadata writer so that no other change comes
+// between.
+func updateShoppingList(change func(items []ShoppingItem) []ShoppingItem) error {
+	return withMeta(func() error {
+		items, err := readShoppingList()
+		if err != nil {
+			return err
+		}
+		items = change(items)
+
+		var body string
+		for _, item := range items {
+			if item.Checked {
+				body += "[x] " + item.Text + "\n"
+			} else {
+				body += "[ ] " + item.Text + "\n"
+			}
+		}
+		return ioutil.WriteFile(filepath.Join(pagesDir, shoppingListFile), []byte(body), fileMode)
+	})
+}
+
+// addToShoppingList adds ingredient lines to the items still to buy.  A line
+// for an ingredient already on the list is merged into it, adding up the
+// quantities when the units can be converted, and is otherwise added as a new
+// item.
+func addToShoppingList(items []ShoppingItem, lines []string) []ShoppingItem {
+	for _, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name := shoppingKey(line)
+		added, ok := parseIngredient(line)
+
+		merged := false
+		for i, item := range items {
+			if item.Checked || shoppingKey(item.Text) != name {
+				continue
+			}
+
+			have, haveOK := parseIngredient(item.Text)
+			if !ok && !haveOK {
+				// Two lines like "salt to taste" only need listing once.
+				merged = true
+				break
+			}
+			if !ok || !haveOK || added.Max != 0 || have.Max != 0 {
+				continue
+			}
+			extra, convertible := convertQuantity(added.Quantity, added.Unit, have.Unit)
+			if !convertible {
+				continue
+			}
+
+			total := have.Quantity + extra
+			text := have.Prefix + formatQuantity(total)
+			if have.Unit != "" {
+				text += " " + unitLabel(have.Unit, total)
+			}
+			if have.Item != "" {
+				text += " " + have.Item
+			}
+			items[i].Text = text
+			merged = true
+			break
+		}
+
+		if !merged {
+			items = append(items, ShoppingItem{Text: line})
+		}
+	}
+	return items
+}
+
+// shoppingKey is what two lines must share to be the same ingredient on the
+// shopping list: the stemmed words of the name, without descriptions like
+// "large", so that "1 egg" and "2 large eggs" match.
+func shoppingKey(line string) string {
+	var key []string
+	for _, word := range words(ingredientName(line)) {
+		if !ingredientDescriptors[word] {
+			key = append(key, word)
+		}
+	}
+	return strings.Join(key, " ")
+}
+
+// shoppingListHandler shows the shopping list.  A POST changes it according
+// to its action: add puts the ingredients of the recipe named by the recipe
+// field on the list, check marks the items whose indexes are given in the
+// checked fields as bought, and clear empties the list.
+func shoppingListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		var change func(items []ShoppingItem) []ShoppingItem
+		redirect := basePath + "/list"
+
+		switch r.FormValue("action") {
+		case "add":
+			recipe := r.FormValue("recipe")
+			p, err := loadPage(recipe)
+			if !validTitle.MatchString(recipe) || err != nil {
+				http.Error(w, "no such recipe", http.StatusBadRequest)
+				return
+			}
+			change = func(items []ShoppingItem) []ShoppingItem {
+				return addToShoppingList(items, ingredientLines(p.Ingredients))
+			}
+			redirect = basePath + "/view/" + recipe
+		case "check":
+			checked := make(map[int]bool)
+			for _, v := range r.Form["checked"] {
+				if i, err := strconv.Atoi(v); err == nil {
+					checked[i] = true
+				}
+			}
+			change = func(items []ShoppingItem) []ShoppingItem {
+				for i := range items {
+					items[i].Checked = checked[i]
+				}
+				return items
+			}
+		case "clear":
+			change = func(items []ShoppingItem) []ShoppingItem { return nil }
+		default:
+			http.Error(w, "unknown action", http.StatusBadRequest)
+			return
+		}
+
+		if err := updateShoppingList(change); err != nil {
+			serverError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, redirect, http.StatusFound)
+		return
+	}
+
+	var items []ShoppingItem
+	err := withMeta(func() (err error) {
+		items, err = readShoppingList()
+		return err
+	})
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	s := &ShoppingListPage{
+		Title: "Shopping List",
+		Items: items,
+		Theme: chooseTheme(w, r),
+		Index: pages}
+
+	err = templates.ExecuteTemplate(w, "shoppinglist.html", s)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Letters which do not decompose into a plain letter and an accent, spelled
+// out the way they usually are in ASCII.
+var foldedLetters = map[rune]string{
+	'ß': "ss", 'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe",
+	'Ø': "O", 'ø': "o", 'Ł': "L", 'ł': "l", 'Đ': "D", 'đ': "d",
+	'Þ': "Th", 'þ': "th", 'ı': "i",
+}
+
+// foldAccents returns s with the accents taken off its letters, so that
+// "Crème Brûlée" becomes "Creme Brulee".  Letters with no plain form, such as
+// those of other scripts, are left as they are.
+func foldAccents(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if folded, ok := foldedLetters[r]; ok {
+			b.WriteString(folded)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// fallbackFilename names a recipe whose title has nothing left once it is made
+// into a filename.  The name comes from a hash of the title, so the same title
+// always gets the same one.
+func fallbackFilename(title string) string {
+	h := fnv.New32a()
+	h.Write([]byte(title))
+	return fmt.Sprintf("Recipe-%08x", h.Sum32())
+}
@@ -0,0 +1,108 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestConvertTitleToFilename(t *testing.T) {
+	tests := []struct {
+		title, want string
+	}{
+		{"Apple Pie", "Apple-Pie"},
+		{"Crème Brûlée", "Creme-Brulee"},
+		{"Jalapeño  Poppers", "Jalapeno-Poppers"},
+		{"Smørrebrød", "Smorrebrod"},
+		{"Straßenkuchen", "Strassenkuchen"},
+		{"Œufs en Meurette", "OEufs-en-Meurette"},
+		{"Bánh Mì", "Banh-Mi"},
+		{"Mom's Chili!", "Moms-Chili"},
+		{"", ""},
+		{"   ", ""},
+		{"!!!", ""},
+	}
+	for _, tt := range tests {
+		if got := convertTitleToFilename(tt.title); got != tt.want {
+			t.Errorf("convertTitleToFilename(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestConvertTitleToFilenameOtherScripts(t *testing.T) {
+	for _, title := range []string{"麻婆豆腐", "Борщ", "חלה", "カレー"} {
+		got := convertTitleToFilename(title)
+		if !validTitle.MatchString(got) {
+			t.Errorf("convertTitleToFilename(%q) = %q, which is not a valid filename", title, got)
+		}
+		if again := convertTitleToFilename(title); again != got {
+			t.Errorf("convertTitleToFilename(%q) gave %q and then %q", title, got, again)
+		}
+	}
+	if convertTitleToFilename("麻婆豆腐") == convertTitleToFilename("宫保鸡丁") {
+		t.Error("two different titles were given the same filename")
+	}
+}
+
+// A link to a recipe by its title, as written, leads to the filename the
+// recipe was saved under.
+func TestWikiLinkRoundTrip(t *testing.T) {
+	useMemStore(t)
+	for _, title := range []string{"Crème Brûlée", "Smørrebrød", "麻婆豆腐", "Борщ"} {
+		p := &Page{Title: title, Ingredients: "- cream\n", Instructions: "Cook.\n"}
+		if err := savePage(p, ""); err != nil {
+			t.Fatalf("saving %q: %v", title, err)
+		}
+
+		got := string(convertWikiMarkup([]byte("See [[" + title + "]].")))
+		want := `See <a href="/view/` + p.Filename + `">` + title + `</a>.`
+		if got != want {
+			t.Errorf("link to %q = %q, want %q", title, got, want)
+		}
+
+		loaded, err := loadPage(p.Filename)
+		if err != nil || loaded.Title != title {
+			t.Errorf("loading %s: got %v, %v, want the title %q", p.Filename, loaded, err, title)
+		}
+	}
+}
+
+// Links to a page saved before accents were folded find it by its title.
+func TestWikiLinkLegacyFilename(t *testing.T) {
+	s := useMemStore(t)
+	s.Save("Crme-Brle", []byte("<!-- Title -->\nCrème Brûlée\n<!-- Ingredients -->\n- cream\n<!-- Instructions -->\nTorch.\n"))
+	refreshIndex()
+
+	got := string(convertWikiMarkup([]byte("See [[Crème Brûlée]].")))
+	want := `See <a href="/view/Crme-Brle">Crème Brûlée</a>.`
+	if got != want {
+		t.Errorf("link to the older page = %q, want %q", got, want)
+	}
+}
+
+// Pages saved before accents were folded keep their filenames until they are
+// renamed.
+func TestSaveKeepsOlderFilename(t *testing.T) {
+	s := useMemStore(t)
+	s.Save("Crme-Brle", []byte("<!-- Title -->\nCrème Brûlée\n<!-- Ingredients -->\n- cream\n<!-- Instructions -->\nTorch.\n"))
+	refreshIndex()
+
+	form := url.Values{"recipeTitle": {"Crème Brûlée"}, "ingredients": {"- cream\n- sugar"}, "instructions": {"Torch."}}
+	w := serve(makeHandler(saveHandler), "POST", "/save/Crme-Brle", form)
+	if loc := w.Header().Get("Location"); loc != "/view/Crme-Brle" {
+		t.Fatalf("saving the same title redirected to %q, want /view/Crme-Brle", loc)
+	}
+	if body, _ := s.Load("Crme-Brle"); !strings.Contains(string(body), "- sugar") {
+		t.Errorf("the change was not saved:\n%s", body)
+	}
+
+	form.Set("recipeTitle", "Crème Brûlée Tart")
+	w = serve(makeHandler(saveHandler), "POST", "/save/Crme-Brle", form)
+	if loc := w.Header().Get("Location"); loc != "/view/Creme-Brulee-Tart" {
+		t.Errorf("renaming redirected to %q, want /view/Creme-Brulee-Tart", loc)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"os"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore keeps every page, and the snapshots of them, in a single SQLite
+// database file, which is easier to back up than a directory of files and
+// changes each page atomically.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS pages (
+	filename TEXT PRIMARY KEY,
+	body     BLOB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS history (
+	filename TEXT NOT NULL,
+	stamp    TEXT NOT NULL,
+	body     BLOB NOT NULL,
+	PRIMARY KEY (filename, stamp)
+);`
+
+// openSQLiteStore opens the database in file, creating it and its tables if
+// they do not exist yet.
+func openSQLiteStore(file string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) Load(filename string) ([]byte, error) {
+	var body []byte
+	err := s.db.QueryRow("SELECT body FROM pages WHERE filename = ?", filename).Scan(&body)
+	if err == sql.ErrNoRows {
+		return nil, os.ErrNotExist
+	}
+	return body, err
+}
+
+func (s *sqliteStore) Save(filename string, body []byte) error {
+	_, err := s.db.Exec(`INSERT INTO pages (filename, body) VALUES (?, ?)
+		ON CONFLICT (filename) DO UPDATE SET body = excluded.body`, filename, body)
+	return err
+}
+
+func (s *sqliteStore) List() ([]string, error) {
+	rows, err := s.db.Query("SELECT filename FROM pages ORDER BY filename")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (s *sqliteStore) Delete(filename string) error {
+	result, err := s.db.Exec("DELETE FROM pages WHERE filename = ?", filename)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// Snapshot copies the current contents of a page into the history table.
+func (s *sqliteStore) Snapshot(filename, stamp string) error {
+	result, err := s.db.Exec(`INSERT INTO history (filename, stamp, body)
+		SELECT filename, ?, body FROM pages WHERE filename = ?`, stamp, filename)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// Snapshots returns the timestamps of a page's snapshots, oldest first.
+func (s *sqliteStore) Snapshots(filename string) ([]string, error) {
+	rows, err := s.db.Query("SELECT stamp FROM history WHERE filename = ? ORDER BY stamp", filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stamps []string
+	for rows.Next() {
+		var stamp string
+		if err := rows.Scan(&stamp); err != nil {
+			return nil, err
+		}
+		stamps = append(stamps, stamp)
+	}
+	return stamps, rows.Err()
+}
+
+// LoadSnapshot reads the snapshot of a page taken at the timestamp.
+func (s *sqliteStore) LoadSnapshot(filename, stamp string) ([]byte, error) {
+	var body []byte
+	err := s.db.QueryRow("SELECT body FROM history WHERE filename = ? AND stamp = ?", filename, stamp).Scan(&body)
+	if err == sql.ErrNoRows {
+		return nil, os.ErrNotExist
+	}
+	return body, err
+}
@@ -0,0 +1,112 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parseMakeAgain reads the MakeAgain section, which holds the latest answer
+// and how many times the question has been answered, like "yes 3".
+func parseMakeAgain(section string) (string, int) {
+	fields := strings.Fields(section)
+	if len(fields) == 0 || (fields[0] != "yes" && fields[0] != "no") {
+		return "", 0
+	}
+
+	count := 1
+	if len(fields) > 1 {
+		if n, err := strconv.Atoi(fields[1]); err == nil && n > 0 {
+			count = n
+		}
+	}
+	return fields[0], count
+}
+
+// formatMakeAgain is the inverse of parseMakeAgain.  An untried recipe has
+// no section.
+func formatMakeAgain(answer string, count int) string {
+	if answer == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s %d", answer, count)
+}
+
+// madeItAgainHandler records whether the recipe is worth making again, from
+// a value of yes or no, and counts the answer.
+func madeItAgainHandler(w http.ResponseWriter, r *http.Request, title string) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	value := r.FormValue("value")
+	if value != "yes" && value != "no" {
+		http.Error(w, "value must be yes or no", http.StatusBadRequest)
+		return
+	}
+
+	err := updatePage(title, func(p *Page) error {
+		p.MakeAgain = value
+		p.MadeCount++
+		return nil
+	})
+	if os.IsNotExist(err) {
+		notFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, basePath+"/view/"+title, http.StatusFound)
+}
+
+// StatsPage summarizes the recipes in the wiki.
+type StatsPage struct {
+	Title   string
+	Recipes int
+	Keepers int
+	Nevers  int
+	Untried int
+	Theme   string
+	Index   Pages
+}
+
+// statsHandler shows the summary.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	s := &StatsPage{
+		Title: "Stats",
+		Theme: chooseTheme(w, r),
+		Index: pages}
+
+	for _, entry := range pages[1:] {
+		p, err := loadPage(entry.Filename)
+		if err != nil || p.Collection != "" {
+			continue
+		}
+
+		s.Recipes++
+		switch p.MakeAgain {
+		case "yes":
+			s.Keepers++
+		case "no":
+			s.Nevers++
+		default:
+			s.Untried++
+		}
+	}
+
+	err := templates.ExecuteTemplate(w, "stats.html", s)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
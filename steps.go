@@ -0,0 +1,65 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+)
+
+// The tags which open and close lists and list items.
+var listTag = regexp.MustCompile(`<(/?)(ol|ul|li)\b[^>]*>`)
+
+// numberSteps gives each step of rendered instructions an anchor, like
+// <li id="step-3">.  The steps are the items of the outermost numbered lists,
+// counted through the whole of the instructions.  It returns the number of
+// steps found.
+func numberSteps(text []byte) ([]byte, int) {
+	var out bytes.Buffer
+	var lists []string // the open lists, innermost last
+	steps := 0
+
+	last := 0
+	for _, m := range listTag.FindAllSubmatchIndex(text, -1) {
+		out.Write(text[last:m[0]])
+		last = m[1]
+
+		closing := m[3] > m[2]
+		name := string(text[m[4]:m[5]])
+
+		switch {
+		case name == "li" && !closing && len(lists) == 1 && lists[0] == "ol":
+			steps++
+			out.WriteString(`<li id="step-` + strconv.Itoa(steps) + `"` + string(text[m[0]+len("<li"):m[1]]))
+			continue
+		case name != "li" && !closing:
+			lists = append(lists, name)
+		case name != "li" && closing && len(lists) > 0:
+			lists = lists[:len(lists)-1]
+		}
+		out.Write(text[m[0]:m[1]])
+	}
+	out.Write(text[last:])
+
+	return out.Bytes(), steps
+}
+
+// A reference to a step of the instructions, like (step 3).
+var stepReference = regexp.MustCompile(`\(step (\d+)\)`)
+
+// linkSteps turns each (step N) in rendered instructions into a link to that
+// step's anchor.  References to steps which do not exist are left as text.
+func linkSteps(text []byte, steps int) []byte {
+	return mapText(text, func(run []byte) []byte {
+		return stepReference.ReplaceAllFunc(run, func(ref []byte) []byte {
+			n, err := strconv.Atoi(string(stepReference.FindSubmatch(ref)[1]))
+			if err != nil || n < 1 || n > steps {
+				return ref
+			}
+			return []byte(`(<a href="#step-` + strconv.Itoa(n) + `">step ` + strconv.Itoa(n) + `</a>)`)
+		})
+	})
+}
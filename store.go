@@ -0,0 +1,206 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Store holds the raw contents of the wiki's pages keyed by filename.
+// Filenames are bare, as they appear in URLs, without any extension.
+type Store interface {
+	Load(filename string) ([]byte, error)
+	Save(filename string, body []byte) error
+	List() ([]string, error)
+	Delete(filename string) error
+}
+
+// A modTimer is a Store which can tell when each page was last saved.
+type modTimer interface {
+	ModTime(filename string) (time.Time, error)
+}
+
+// store is where every page is loaded from and saved to.
+var store Store = fileStore{dir: pagesDir}
+
+// pageExt is the extension of the files pages are kept in.
+var pageExt = ".txt"
+
+// fileStore keeps each page in a file in dir, or in a category subdirectory of
+// dir when the filename has a category.  Only files ending in pageExt are
+// pages.
+type fileStore struct {
+	dir string
+}
+
+// errUnsafeFilename is returned for a filename which is not a page filename,
+// and so might name a file outside the pages directory.
+var errUnsafeFilename = errors.New("not a valid page filename")
+
+// safePagePath returns the path of the file in dir which a page filename is
+// kept in, with ext added.  The filename may only be letters, digits and
+// dashes, with at most one category before a slash, so it can have no .. or
+// other separators to reach outside dir.  Every path built from a page
+// filename should come from here.
+func safePagePath(dir, filename, ext string) (string, error) {
+	if !validTitle.MatchString(filename) {
+		return "", errUnsafeFilename
+	}
+	return filepath.Join(dir, filepath.FromSlash(filename)+ext), nil
+}
+
+func (s fileStore) path(filename string) (string, error) {
+	return safePagePath(s.dir, filename, pageExt)
+}
+
+func (s fileStore) Load(filename string) ([]byte, error) {
+	path, err := s.path(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
+
+func (s fileStore) Save(filename string, body []byte) error {
+	path, err := s.path(filename)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, body, fileMode)
+}
+
+func (s fileStore) ModTime(filename string) (time.Time, error) {
+	path, err := s.path(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// List returns every page in dir and in its category subdirectories.  Dot
+// files, such as the history directory, are skipped, as are symlinks, pipes
+// and anything else which is not a regular file.
+func (s fileStore) List() ([]string, error) {
+	var names []string
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == s.dir {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			// Categories are only one level deep.
+			if strings.Contains(rel, "/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Files named unlike a page could not be loaded again.
+		name := strings.TrimSuffix(rel, pageExt)
+		if info.Mode().IsRegular() && strings.HasSuffix(rel, pageExt) && validTitle.MatchString(name) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// Delete removes a page, and its category subdirectory if that leaves it
+// empty.
+func (s fileStore) Delete(filename string) error {
+	path, err := s.path(filename)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != filepath.Clean(s.dir) {
+		os.Remove(dir)
+	}
+	return nil
+}
+
+// memStore keeps pages in memory.  Tests swap it in for store so that the
+// handlers can be run without touching the disk.
+type memStore struct {
+	mu    sync.Mutex
+	pages map[string][]byte
+}
+
+func newMemStore() *memStore {
+	return &memStore{pages: make(map[string][]byte)}
+}
+
+func (s *memStore) Load(filename string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, ok := s.pages[filename]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return append([]byte(nil), body...), nil
+}
+
+func (s *memStore) Save(filename string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pages[filename] = append([]byte(nil), body...)
+	return nil
+}
+
+func (s *memStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.pages))
+	for name := range s.pages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *memStore) Delete(filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pages[filename]; !ok {
+		return os.ErrNotExist
+	}
+	delete(s.pages, filename)
+	return nil
+}
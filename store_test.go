@@ -0,0 +1,76 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Only regular files named like pages, at the top or one category deep, are
+// listed as pages.
+func TestFileStoreListMixedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string) {
+		t.Helper()
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("<!-- Title -->\nx\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("Apple-Pie.txt")
+	write("Desserts/Lemon-Tart.txt")
+	write("notes.md")
+	write("Apple-Pie.txt~")
+	write("Bad Name.txt")
+	write(".pinned")
+	write(".history/Apple-Pie/1.txt")
+	write("Desserts/Cakes/Sponge.txt")
+	if err := os.Mkdir(filepath.Join(dir, "Empty.txt"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "Apple-Pie.txt"), filepath.Join(dir, "Link.txt")); err != nil {
+		t.Skip("symlinks are not supported here:", err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "Missing.txt"), filepath.Join(dir, "Dangling.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := fileStore{dir: dir}.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Apple-Pie", "Desserts/Lemon-Tart"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("List() = %q, want %q", names, want)
+	}
+}
+
+func TestFileStoreListOtherExtension(t *testing.T) {
+	old := pageExt
+	pageExt = ".md"
+	defer func() { pageExt = old }()
+
+	dir := t.TempDir()
+	for _, name := range []string{"Apple-Pie.md", "Lemon-Tart.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err := fileStore{dir: dir}.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Apple-Pie"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("List() = %q, want %q", names, want)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"html"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// substitution is what can be used in place of an ingredient.
+type substitution struct {
+	name        []string // the stemmed words of the name
+	label       string   // the name as written in the table
+	suggestions []string
+}
+
+//go:embed data/substitutions.csv
+var substitutionData []byte
+
+// substitutionTable is parsed from substitutionData, longest names first so
+// that "brown sugar" is matched before "sugar".
+var substitutionTable = parseSubstitutionTable(substitutionData)
+
+// substitutionTips adds the substitutions for each ingredient to its line in
+// the view as a tooltip.
+var substitutionTips bool
+
+func parseSubstitutionTable(data []byte) []substitution {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	rows, err := r.ReadAll()
+	if err != nil {
+		log.Fatalf("unable to read the substitution table: %v", err)
+	}
+
+	var table []substitution
+	index := make(map[string]int)
+	for _, row := range rows[1:] {
+		label := strings.TrimSpace(row[0])
+		i, ok := index[label]
+		if !ok {
+			i = len(table)
+			index[label] = i
+			table = append(table, substitution{name: words(label), label: label})
+		}
+		table[i].suggestions = append(table[i].suggestions, strings.TrimSpace(row[1]))
+	}
+	sort.SliceStable(table, func(i, j int) bool {
+		return len(table[i].name) > len(table[j].name)
+	})
+	return table
+}
+
+// substitutesFor finds the substitutions for the ingredient named on a line,
+// which may be a whole ingredient line like "1 cup buttermilk".
+func substitutesFor(line string) (substitution, bool) {
+	have := words(ingredientName(line))
+	if len(have) == 0 {
+		return substitution{}, false
+	}
+	for _, s := range substitutionTable {
+		if containsWords(have, s.name) {
+			return s, true
+		}
+	}
+	return substitution{}, false
+}
+
+// A rendered list item, with any attributes already added to it.
+var attributedItem = regexp.MustCompile(`(?s)<li([^>]*)>(.*?)</li>`)
+
+// annotateSubstitutions adds a title to each rendered ingredient which has
+// substitutions, so that they show when the pointer rests on it.
+func annotateSubstitutions(rendered []byte) []byte {
+	return attributedItem.ReplaceAllFunc(rendered, func(item []byte) []byte {
+		m := attributedItem.FindSubmatch(item)
+		if bytes.Contains(m[1], []byte("title=")) {
+			return item
+		}
+		text := html.UnescapeString(string(anyTag.ReplaceAll(m[2], nil)))
+
+		s, ok := substitutesFor(strings.TrimSpace(text))
+		if !ok {
+			return item
+		}
+
+		title := "Instead of " + s.label + ": " + strings.Join(s.suggestions, "; or ")
+		attrs := string(m[1]) + ` class="substitutable" title="` + html.EscapeString(title) + `"`
+		return []byte("<li" + attrs + ">" + string(m[2]) + "</li>")
+	})
+}
+
+// SubstitutePage lists the substitutions for an ingredient.
+type SubstitutePage struct {
+	Title       string
+	Ingredient  string
+	Match       string
+	Suggestions []string
+	Theme       string
+	Index       Pages
+}
+
+// apiSubstitutes is the JSON form of a SubstitutePage.
+type apiSubstitutes struct {
+	Ingredient  string   `json:"ingredient"`
+	Match       string   `json:"match,omitempty"`
+	Suggestions []string `json:"suggestions"`
+}
+
+// substituteHandler suggests substitutions for the ingredient named in the
+// path, as in /substitute/buttermilk, or in the ingredient parameter.  Clients
+// which accept JSON get the suggestions as JSON.
+func substituteHandler(w http.ResponseWriter, r *http.Request) {
+	ingredient := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/substitute/"))
+	if ingredient == "" {
+		ingredient = strings.TrimSpace(r.FormValue("ingredient"))
+	}
+
+	sp := &SubstitutePage{
+		Title:      "Substitutions",
+		Ingredient: ingredient}
+	if s, ok := substitutesFor(ingredient); ok {
+		sp.Match = s.label
+		sp.Suggestions = s.suggestions
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if wantsJSON(r) {
+		result := apiSubstitutes{
+			Ingredient:  sp.Ingredient,
+			Match:       sp.Match,
+			Suggestions: sp.Suggestions}
+		if result.Suggestions == nil {
+			result.Suggestions = []string{}
+		}
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	sp.Theme = chooseTheme(w, r)
+	sp.Index = pages
+	err := templates.ExecuteTemplate(w, "substitute.html", sp)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
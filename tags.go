@@ -0,0 +1,112 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RetagPage reports the recipes affected by renaming a tag.
+type RetagPage struct {
+	Title   string
+	From    string
+	To      string
+	DryRun  bool
+	Changed []*Page
+	Theme   string
+}
+
+// parseTags splits a comma or line separated list of tags.  Blank and
+// repeated tags are dropped.
+func parseTags(text string) []string {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	})
+	return mergeTags(nil, fields)
+}
+
+// mergeTags returns the tags in a followed by those in b, keeping only the
+// first of any which are the same apart from case.
+func mergeTags(a, b []string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	for _, tag := range append(append([]string{}, a...), b...) {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// retagHandler renames the tag from to the tag to in every recipe.  Unless the
+// request is a POST without the dryrun parameter it only reports which
+// recipes would change.
+func retagHandler(w http.ResponseWriter, r *http.Request) {
+	from := strings.TrimSpace(r.FormValue("from"))
+	to := strings.TrimSpace(r.FormValue("to"))
+	if from == "" || to == "" || strings.ContainsAny(from+to, ",\n") {
+		http.Error(w, "from and to must each name a single tag.", http.StatusBadRequest)
+		return
+	}
+	if hasCommentMarkup(to) {
+		http.Error(w, errSectionMarker.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rt := &RetagPage{
+		Title:  "Rename tag " + from + " to " + to,
+		From:   from,
+		To:     to,
+		DryRun: r.Method != "POST" || r.FormValue("dryrun") != "",
+		Theme:  chooseTheme(w, r)}
+
+	// Each recipe is loaded and saved again whole, so hold off other updates
+	// which could be lost in between.
+	if !rt.DryRun {
+		updateMu.Lock()
+		defer updateMu.Unlock()
+	}
+
+	for _, entry := range pages[1:] {
+		p, err := loadPage(entry.Filename)
+		if err != nil {
+			continue
+		}
+
+		found := false
+		tags := make([]string, len(p.Tags))
+		for i, tag := range p.Tags {
+			if strings.EqualFold(tag, from) {
+				tag = to
+				found = true
+			}
+			tags[i] = tag
+		}
+		if !found {
+			continue
+		}
+
+		p.Tags = mergeTags(nil, tags)
+		if !rt.DryRun {
+			if err := p.save(); err != nil {
+				serverError(w, r, err)
+				return
+			}
+		}
+		rt.Changed = append(rt.Changed, p)
+	}
+
+	err := templates.ExecuteTemplate(w, "retag.html", rt)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
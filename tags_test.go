@@ -0,0 +1,20 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRetagCommentMarkup(t *testing.T) {
+	useMemStore(t)
+
+	w := serve(retagHandler, "POST", "/retag", url.Values{"from": {"dessert"}, "to": {"<!--"}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status of renaming a tag to <!-- = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// The longest line taken for a title.
+const maxHeadingLength = 60
+
+// importText splits a recipe pasted as plain text, such as from an email, into
+// a page.  A short first line is the title.  Lines like "Ingredients:" and
+// "Directions:" divide the sections when there are any.  Otherwise the
+// ingredients are the block of lines with the most which start with a
+// quantity, and the instructions are what follows.  When it cannot find the
+// ingredients everything goes into the instructions and confident is false.
+func importText(text string) (p *Page, confident bool) {
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t\r")
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+
+	p = &Page{}
+	if len(lines) > 0 && isTitleLine(lines[0]) {
+		p.Title = strings.TrimSpace(lines[0])
+		lines = lines[1:]
+	}
+
+	ingredients, instructions, ok := splitByHeadings(lines)
+	if !ok {
+		ingredients, instructions, ok = splitByQuantities(lines)
+	}
+	if !ok {
+		ingredients, instructions = nil, lines
+	}
+
+	var b strings.Builder
+	for _, line := range ingredients {
+		if line = strings.TrimSpace(line); line != "" {
+			b.WriteString("- " + strings.TrimSpace(listMarker.ReplaceAllString(line, "")) + "\n")
+		}
+	}
+	p.Ingredients = template.HTML(b.String())
+	p.Instructions = template.HTML(strings.TrimSpace(strings.Join(instructions, "\n")) + "\n")
+
+	return p, ok
+}
+
+// isTitleLine reports whether a line could be a recipe's title: short, and
+// neither an ingredient nor a sentence.
+func isTitleLine(line string) bool {
+	line = strings.TrimSpace(line)
+	if _, ok := parseIngredient(line); ok {
+		return false
+	}
+	return line != "" && len(line) <= maxHeadingLength && !strings.HasSuffix(line, ".") && !isSectionHeading(line)
+}
+
+// isSectionHeading reports whether a line names the ingredients or the
+// instructions section.  A heading is a few words, so that a sentence like
+// "Mix the ingredients" is not taken for one.
+func isSectionHeading(line string) bool {
+	line = strings.TrimSpace(line)
+	return len(strings.Fields(line)) <= 3 && !strings.HasSuffix(line, ".") &&
+		(ingredientHeading.MatchString(line) || instructionHeading.MatchString(line))
+}
+
+// splitByHeadings divides the lines at headings like "Ingredients:".  It
+// needs both an ingredients and an instructions heading to succeed.
+func splitByHeadings(lines []string) (ingredients, instructions []string, ok bool) {
+	var sawIngredients, sawInstructions bool
+	section := ""
+	for _, line := range lines {
+		if isSectionHeading(line) {
+			if ingredientHeading.MatchString(line) {
+				section, sawIngredients = "ingredients", true
+			} else {
+				section, sawInstructions = "instructions", true
+			}
+			continue
+		}
+		switch section {
+		case "ingredients":
+			ingredients = append(ingredients, line)
+		case "instructions":
+			instructions = append(instructions, line)
+		}
+	}
+	return ingredients, instructions, sawIngredients && sawInstructions
+}
+
+// splitByQuantities finds the block of lines, between blank lines, in which
+// most lines start with a quantity, taking the one with the most quantities.
+// That block is the ingredients and the lines after it the instructions.  At
+// least two lines must have quantities and some instructions must follow.
+func splitByQuantities(lines []string) (ingredients, instructions []string, ok bool) {
+	bestStart, bestEnd, bestCount := 0, 0, 0
+	for start := 0; start < len(lines); {
+		end := start
+		for end < len(lines) && strings.TrimSpace(lines[end]) != "" {
+			end++
+		}
+
+		count := 0
+		for _, line := range lines[start:end] {
+			if _, ok := parseIngredient(strings.TrimSpace(line)); ok {
+				count++
+			}
+		}
+		if count >= 2 && count*3 >= (end-start)*2 && count > bestCount {
+			bestStart, bestEnd, bestCount = start, end, count
+		}
+		start = end + 1
+	}
+
+	if bestCount == 0 {
+		return nil, nil, false
+	}
+	instructions = lines[bestEnd:]
+	if strings.TrimSpace(strings.Join(instructions, "")) == "" {
+		return nil, nil, false
+	}
+	// Anything before the ingredients, such as a note from the sender, is
+	// kept at the top of the instructions.
+	instructions = append(append([]string{}, lines[:bestStart]...), instructions...)
+	return lines[bestStart:bestEnd], instructions, true
+}
+
+// importTextHandler splits pasted text into a recipe and shows it in the edit
+// form for review.  Nothing is saved until the form is.
+func importTextHandler(w http.ResponseWriter, r *http.Request) {
+	p, confident := importText(r.FormValue("text"))
+	if title := strings.TrimSpace(r.FormValue("recipeTitle")); title != "" {
+		p.Title = title
+	}
+	if p.Title == "" {
+		p.Title = "Imported Recipe"
+	}
+
+	// Review under a filename not yet taken so that saving cannot replace
+	// another recipe.
+	filename := convertTitleToFilename(p.Title)
+	if filename == "" {
+		filename = "Imported-Recipe"
+	}
+	p.Filename = uniqueFilename(filename, "")
+
+	p.Notice = "Check how the recipe was divided, then save it."
+	if !confident {
+		p.Notice = "The ingredients could not be told apart from the instructions, so all of the text is under Instructions.  Move the ingredients, then save it."
+	}
+	renderTemplate(w, r, "edit", p)
+}
@@ -0,0 +1,45 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// The themes which may be chosen.  Each has a stylesheet of the same name in
+// resources/.
+var themes = []string{"light", "dark"}
+
+const defaultTheme = "light"
+
+// validTheme reports whether name is one of the themes.
+func validTheme(name string) bool {
+	for _, t := range themes {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// chooseTheme returns the theme for a request.  A theme given by the theme
+// parameter is remembered in a cookie for later requests.
+func chooseTheme(w http.ResponseWriter, r *http.Request) string {
+	if name := r.FormValue("theme"); validTheme(name) {
+		http.SetCookie(w, &http.Cookie{
+			Name:    "theme",
+			Value:   name,
+			Path:    basePath + "/",
+			Expires: time.Now().AddDate(1, 0, 0)})
+		return name
+	}
+
+	if c, err := r.Cookie("theme"); err == nil && validTheme(c.Value) {
+		return c.Value
+	}
+
+	return defaultTheme
+}
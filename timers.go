@@ -0,0 +1,90 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// When timers is set, durations in the instructions, like "20 minutes", are
+// marked up so that the page can offer to time them.
+var timers bool
+
+// A duration in the text: an amount, or a range of amounts, and a unit,
+// optionally followed by a smaller amount, as in "1 hour and 30 minutes".
+var durationPattern = regexp.MustCompile(`(?i)\b(\d+(?:\.\d+)?|an?|one)(?:\s*(?:-|–|to)\s*(\d+(?:\.\d+)?))?\s*(hours?|hrs?|minutes?|mins?|seconds?|secs?)\b` +
+	`(?:,?\s*(?:and\s+)?(\d+)\s*(minutes?|mins?|seconds?|secs?)\b)?`)
+
+// unitSeconds returns the number of seconds in a unit of time.
+func unitSeconds(unit string) float64 {
+	switch unit = strings.ToLower(unit); {
+	case strings.HasPrefix(unit, "h"):
+		return 3600
+	case strings.HasPrefix(unit, "m"):
+		return 60
+	}
+	return 1
+}
+
+// parseAmount reads the amount of a duration, where "a" and "one" mean 1.
+func parseAmount(amount string) (float64, bool) {
+	switch strings.ToLower(amount) {
+	case "a", "an", "one":
+		return 1, true
+	}
+	n, err := strconv.ParseFloat(amount, 64)
+	return n, err == nil
+}
+
+// parseDuration reads a duration matched by durationPattern, returning its
+// length in seconds and, for a range, the length of its upper end.  max is
+// zero when there is no range.
+func parseDuration(m []string) (seconds, max int, ok bool) {
+	amount, ok := parseAmount(m[1])
+	if !ok {
+		return 0, 0, false
+	}
+	unit := unitSeconds(m[3])
+
+	extra := 0.0
+	if m[4] != "" {
+		n, _ := strconv.ParseFloat(m[4], 64)
+		extra = n * unitSeconds(m[5])
+	}
+
+	seconds = int(amount*unit + extra)
+	if m[2] != "" {
+		upper, err := strconv.ParseFloat(m[2], 64)
+		if err != nil || upper < amount {
+			return 0, 0, false
+		}
+		max = int(upper*unit + extra)
+	}
+	return seconds, max, seconds > 0
+}
+
+// markTimers wraps each duration in rendered instructions in a span holding
+// its length, like <span class="timer" data-seconds="1200">20 minutes</span>.
+// A range also gets data-max-seconds.  The text itself is unchanged, and text
+// in links and code is left alone.
+func markTimers(text []byte) []byte {
+	return mapText(text, func(run []byte) []byte {
+		return durationPattern.ReplaceAllFunc(run, func(found []byte) []byte {
+			seconds, max, ok := parseDuration(durationPattern.FindStringSubmatch(string(found)))
+			if !ok {
+				return found
+			}
+
+			attrs := fmt.Sprintf(`class="timer" data-seconds="%d"`, seconds)
+			if max > 0 {
+				attrs += fmt.Sprintf(` data-max-seconds="%d"`, max)
+			}
+			return []byte("<span " + attrs + ">" + string(found) + "</span>")
+		})
+	})
+}
@@ -0,0 +1,50 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"hash/fnv"
+	"net/http"
+	"time"
+)
+
+// recipeOfTheDay picks a recipe from the index for the given day.  The same
+// day always gives the same recipe, as long as the recipes do not change.
+// Menus are left out.  It returns false when there are no recipes.
+func recipeOfTheDay(day time.Time) (IndexEntry, bool) {
+	var recipes []IndexEntry
+	for _, entry := range pages[1:] {
+		if entry.Route == "view" {
+			recipes = append(recipes, entry)
+		}
+	}
+	if len(recipes) == 0 {
+		return IndexEntry{}, false
+	}
+
+	// The recipes are sorted by title so the order is stable too.
+	h := fnv.New32a()
+	h.Write([]byte(day.Format("2006-01-02")))
+	return recipes[h.Sum32()%uint32(len(recipes))], true
+}
+
+// todayHandler shows the recipe of the day with a banner saying so.
+func todayHandler(w http.ResponseWriter, r *http.Request) {
+	entry, ok := recipeOfTheDay(time.Now())
+	if !ok {
+		http.Redirect(w, r, basePath+"/view/"+rootTitle, http.StatusFound)
+		return
+	}
+
+	p, err := loadPage(entry.Filename)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	renderPage(p)
+	p.RecipeOfTheDay = true
+	renderTemplate(w, r, "view", p)
+}
@@ -0,0 +1,67 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxRenderSize, when above zero, is the most bytes of ingredients and
+// instructions a page view renders.  Rendering is done on every request, so
+// an outsized page would otherwise make every view of it slow.
+var maxRenderSize int = 1 << 20
+
+// truncatePage cuts the ingredients and instructions down to maxRenderSize
+// bytes between them, at the end of a line where it can, and reports whether
+// anything was cut.
+func truncatePage(p *Page) bool {
+	if maxRenderSize <= 0 || len(p.Ingredients)+len(p.Instructions) <= maxRenderSize {
+		return false
+	}
+
+	p.Ingredients = template.HTML(truncateText(string(p.Ingredients), maxRenderSize))
+	p.Instructions = template.HTML(truncateText(string(p.Instructions), maxRenderSize-len(p.Ingredients)))
+	return true
+}
+
+// truncateText returns at most the first limit bytes of text, ending at the
+// last line break within them if there is one and never inside a character.
+func truncateText(text string, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	if len(text) <= limit {
+		return text
+	}
+
+	text = text[:limit]
+	if i := strings.LastIndex(text, "\n"); i > 0 {
+		return text[:i+1]
+	}
+	for len(text) > 0 && !utf8.ValidString(text) {
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+// rawHandler returns the stored source of a page as plain text.
+func rawHandler(w http.ResponseWriter, r *http.Request, title string) {
+	body, err := store.Load(title)
+	if os.IsNotExist(err) {
+		notFound(w, r)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(body)
+}
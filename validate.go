@@ -0,0 +1,193 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// validationIssue is a problem found with a recipe before it is saved.
+type validationIssue struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// findSectionMarker reports the first field of the page with a line which
+// would be read back as a section marker, or with a comment left open which
+// would hide the lines after it.  The tags and flags are saved together on one
+// line, so any comment markup in one of them is refused.
+func findSectionMarker(p *Page) (string, bool) {
+	fields := []struct{ name, text string }{
+		{"title", p.Title},
+		{"ingredients", string(p.Ingredients)},
+		{"instructions", string(p.Instructions)},
+		{"prep", p.Prep},
+		{"equipment", p.Equipment},
+		{"servings", p.Servings},
+		{"source", p.Source},
+		{"collection", string(p.Collection)}}
+	for _, field := range fields {
+		if unclosedComment(field.text) {
+			return field.name, true
+		}
+		for _, line := range strings.Split(field.text, "\n") {
+			if _, ok := sectionMarker(line); ok {
+				return field.name, true
+			}
+		}
+	}
+
+	lists := []struct {
+		name  string
+		items []string
+	}{
+		{"tags", p.Tags},
+		{"flags", p.Flags}}
+	for _, list := range lists {
+		for _, item := range list.items {
+			if hasCommentMarkup(item) {
+				return list.name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// hasCommentMarkup reports whether text opens or closes an html comment, and
+// so could be read back as a section marker or hide the sections after it.
+func hasCommentMarkup(text string) bool {
+	return strings.Contains(text, "<!--") || strings.Contains(text, "-->")
+}
+
+// unclosedComment reports whether text opens an html comment which it does not
+// close.
+func unclosedComment(text string) bool {
+	for {
+		start := strings.Index(text, "<!--")
+		if start < 0 {
+			return false
+		}
+		end := strings.Index(text[start+len("<!--"):], "-->")
+		if end < 0 {
+			return true
+		}
+		text = text[start+len("<!--")+end+len("-->"):]
+	}
+}
+
+// validateRecipe checks a page the way savePage would save it over current,
+// which is empty for a new page.  Errors would stop the save.  Warnings are
+// things the save allows but which are probably mistakes.
+func validateRecipe(p *Page, current string) (errs, warnings []validationIssue) {
+	filename := convertTitleToFilename(p.Title)
+	if filename == "" {
+		errs = append(errs, validationIssue{"title", errNoTitle.Error()})
+	}
+	if field, ok := findSectionMarker(p); ok {
+		errs = append(errs, validationIssue{field, errSectionMarker.Error()})
+	}
+	if err := checkVideo(p.Video); err != nil {
+		errs = append(errs, validationIssue{"video", err.Error()})
+	}
+	if err := checkRecipeLimit(current); err != nil {
+		errs = append(errs, validationIssue{"", err.Error()})
+	}
+
+	if filename != "" {
+		want := joinCategory(p.Category, filename)
+		if got := uniqueFilename(want, current); got != want {
+			warnings = append(warnings, validationIssue{"title",
+				fmt.Sprintf("Another recipe is already named %s, so this one would be saved as %s.", want, got)})
+		}
+	}
+
+	if p.Collection == "" {
+		if strings.TrimSpace(string(p.Ingredients)) == "" {
+			warnings = append(warnings, validationIssue{"ingredients", "There are no ingredients."})
+		}
+		if strings.TrimSpace(string(p.Instructions)) == "" {
+			warnings = append(warnings, validationIssue{"instructions", "There are no instructions."})
+		}
+	}
+
+	text := string(p.Ingredients) + "\n" + string(p.Instructions) + "\n" + string(p.Collection)
+	for _, link := range wikiLink.FindAllStringSubmatch(text, -1) {
+		target := resolveLink(convertTitleToFilename(link[1]))
+		if _, err := store.Load(target); os.IsNotExist(err) {
+			warnings = append(warnings, validationIssue{"",
+				fmt.Sprintf("The link [[%s]] is to a recipe which does not exist.", link[1])})
+		}
+	}
+
+	return errs, warnings
+}
+
+// apiValidateRequest is the body accepted by apiValidateHandler: the fields of
+// a save, with the filename of the recipe being edited if it already exists.
+type apiValidateRequest struct {
+	apiSaveRequest
+	Filename string `json:"filename"`
+}
+
+// apiValidateResponse lists what validateRecipe found.
+type apiValidateResponse struct {
+	Valid    bool              `json:"valid"`
+	Errors   []validationIssue `json:"errors"`
+	Warnings []validationIssue `json:"warnings"`
+}
+
+// apiValidateHandler checks a recipe as /api/save would save it, without
+// saving anything, so that a client can point out problems while a recipe
+// is still being written.
+func apiValidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req apiValidateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Filename != "" && !validTitle.MatchString(req.Filename) {
+		writeJSONError(w, "filename is not valid", http.StatusBadRequest)
+		return
+	}
+
+	p := &Page{}
+	if req.Filename != "" {
+		old, err := loadPage(req.Filename)
+		if err != nil && !os.IsNotExist(err) {
+			writeJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err == nil {
+			p = old
+		} else {
+			p.Title = convertFilenameToTitle(req.Filename)
+			p.Category, _ = splitCategory(req.Filename)
+		}
+	}
+	req.apply(p)
+
+	errs, warnings := validateRecipe(p, req.Filename)
+	resp := apiValidateResponse{
+		Valid:    len(errs) == 0,
+		Errors:   errs,
+		Warnings: warnings}
+	if resp.Errors == nil {
+		resp.Errors = []validationIssue{}
+	}
+	if resp.Warnings == nil {
+		resp.Warnings = []validationIssue{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// errBadVideo is returned when a recipe's video is not a web address.
+var errBadVideo = errors.New("The video must be a web address starting with http:// or https://.")
+
+// checkVideo returns errBadVideo unless the video is empty or an http or
+// https URL.
+func checkVideo(video string) error {
+	if video == "" {
+		return nil
+	}
+	u, err := url.Parse(video)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.ContainsAny(video, " \n") {
+		return errBadVideo
+	}
+	return nil
+}
+
+// The IDs YouTube and Vimeo give their videos.
+var (
+	youTubeID = regexp.MustCompile(`^[A-Za-z0-9_-]{6,20}$`)
+	vimeoID   = regexp.MustCompile(`^[0-9]{1,12}$`)
+)
+
+// videoEmbed returns the address of a player for the video which can be shown
+// in an iframe.  Only videos on YouTube and Vimeo can be embedded, so that a
+// recipe cannot put another site's page into the view.  Any other video is
+// shown as a link.
+func videoEmbed(video string) (string, bool) {
+	if checkVideo(video) != nil || video == "" {
+		return "", false
+	}
+	u, _ := url.Parse(video)
+	path := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	switch strings.ToLower(u.Hostname()) {
+	case "youtube.com", "www.youtube.com", "m.youtube.com":
+		id := u.Query().Get("v")
+		if len(path) == 2 && (path[0] == "embed" || path[0] == "shorts" || path[0] == "live") {
+			id = path[1]
+		}
+		if youTubeID.MatchString(id) {
+			return "https://www.youtube-nocookie.com/embed/" + id, true
+		}
+	case "youtu.be":
+		if len(path) == 1 && youTubeID.MatchString(path[0]) {
+			return "https://www.youtube-nocookie.com/embed/" + path[0], true
+		}
+	case "vimeo.com", "www.vimeo.com":
+		if len(path) == 1 && vimeoID.MatchString(path[0]) {
+			return "https://player.vimeo.com/video/" + path[0], true
+		}
+	case "player.vimeo.com":
+		if len(path) == 2 && path[0] == "video" && vimeoID.MatchString(path[1]) {
+			return "https://player.vimeo.com/video/" + path[1], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,158 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The number of times each recipe has been viewed is kept in this file in
+// pagesDir with one "filename: count" line per recipe.
+var viewsFile string = ".views"
+
+// How often counted views are written out.  Counting only changes memory, so
+// a view costs next to nothing.
+var viewsFlushInterval = 30 * time.Second
+
+// The view counts, and whether they have changed since they were written, are
+// only touched by the metadata writer.
+var (
+	views      = make(map[string]int)
+	viewsDirty bool
+)
+
+// loadViews reads the view counts saved by an earlier run.  It must be run by
+// the metadata writer.
+func loadViews() error {
+	body, err := ioutil.ReadFile(filepath.Join(pagesDir, viewsFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(body), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(parts[1])); err == nil {
+			views[strings.TrimSpace(parts[0])] = n
+		}
+	}
+	return nil
+}
+
+// saveViews writes out the view counts if any have changed since they were
+// last written.  It must be run by the metadata writer.
+func saveViews() error {
+	if !viewsDirty {
+		return nil
+	}
+	names := make([]string, 0, len(views))
+	for name := range views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %d\n", name, views[name])
+	}
+	viewsDirty = false
+
+	return ioutil.WriteFile(filepath.Join(pagesDir, viewsFile), []byte(b.String()), fileMode)
+}
+
+// flushViews saves the view counts every viewsFlushInterval.
+func flushViews() {
+	for range time.Tick(viewsFlushInterval) {
+		if err := withMeta(saveViews); err != nil {
+			log.Printf("unable to save the view counts: %v", err)
+		}
+	}
+}
+
+// Words in the User-Agent of crawlers and other clients which are not people.
+var botWords = []string{"bot", "crawl", "spider", "slurp", "curl", "wget", "python"}
+
+// isBot reports whether the request looks like it came from a program rather
+// than someone reading the recipe.
+func isBot(r *http.Request) bool {
+	agent := strings.ToLower(r.UserAgent())
+	if agent == "" || r.Method == "HEAD" {
+		return true
+	}
+	for _, word := range botWords {
+		if strings.Contains(agent, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// countView counts a view of the recipe unless it came from a bot.  The count
+// is queued so that the view does not wait for it.
+func countView(r *http.Request, filename string) {
+	if isBot(r) {
+		return
+	}
+	queueMeta(func() error {
+		views[filename]++
+		viewsDirty = true
+		return nil
+	})
+}
+
+// popularHandler lists the recipes which have been viewed, the most viewed
+// first.
+func popularHandler(w http.ResponseWriter, r *http.Request) {
+	s := &SearchPage{
+		Title: "Popular Recipes",
+		Query: "popular",
+		Theme: chooseTheme(w, r),
+		Index: pages}
+
+	counts := make(map[string]int)
+	withMeta(func() error {
+		for name, n := range views {
+			counts[name] = n
+		}
+		return nil
+	})
+
+	var entries []IndexEntry
+	for _, entry := range pages[1:] {
+		if counts[entry.Filename] > 0 {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return counts[entries[i].Filename] > counts[entries[j].Filename]
+	})
+
+	for _, entry := range entries {
+		viewed, _ := pluralize(counts[entry.Filename], "time")
+		s.Results = append(s.Results, SearchResult{
+			Title:    entry.Title,
+			Filename: entry.Filename,
+			Excerpt:  template.HTML(template.HTMLEscapeString("Viewed " + viewed + "."))})
+	}
+
+	err := templates.ExecuteTemplate(w, "search.html", s)
+	if err != nil {
+		serverError(w, r, err)
+	}
+}
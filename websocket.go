@@ -0,0 +1,240 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// wsConn is the server's end of a WebSocket connection, as described by RFC
+// 6455.  It only does what the live preview needs: text messages, answering
+// pings and closing.
+type wsConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+// The WebSocket opcodes.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// The WebSocket close codes used here.
+const (
+	wsNormalClosure   = 1000
+	wsProtocolError   = 1002
+	wsUnsupportedData = 1003
+	wsMessageTooBig   = 1009
+)
+
+// The GUID a WebSocket handshake appends to the client's key.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// errWSClosed is returned by readMessage once the client closes the
+// connection.
+var errWSClosed = errors.New("websocket closed")
+
+// headerHasToken reports whether the comma separated header contains the
+// token, ignoring case.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebSocket completes the handshake of a WebSocket request and takes
+// over its connection.  On failure it has already responded with an error.
+// Browsers send the Origin of the page making the connection, which must be
+// this wiki, so that another site cannot use a visitor's browser to connect.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != "GET" || !headerHasToken(r.Header, "Connection", "upgrade") ||
+		!headerHasToken(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "A WebSocket connection is required.", http.StatusBadRequest)
+		return nil, errors.New("not a websocket request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Only WebSocket version 13 is supported.", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			http.Error(w, "Cross origin WebSocket connections are not allowed.", http.StatusForbidden)
+			return nil, errors.New("cross origin websocket request")
+		}
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "The connection cannot be upgraded.", http.StatusInternalServerError)
+		return nil, err
+	}
+	// The server's timeouts were meant for ordinary requests.
+	conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, rw: rw}, nil
+}
+
+// readFrame reads one frame from the client, unmasking its payload.
+func (c *wsConn) readFrame(limit int64) (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.rw, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	length := int64(head[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var n [2]byte
+		if _, err = io.ReadFull(c.rw, n[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(n[:]))
+	case 127:
+		var n [8]byte
+		if _, err = io.ReadFull(c.rw, n[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint64(n[:]) & (1<<63 - 1))
+	}
+
+	// Clients must mask what they send, and control frames are small.
+	if !masked || head[0]&0x70 != 0 || (opcode >= wsClose && (length > 125 || !fin)) {
+		c.close(wsProtocolError)
+		return false, 0, nil, errWSClosed
+	}
+	if length > limit {
+		c.close(wsMessageTooBig)
+		return false, 0, nil, errWSClosed
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.rw, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.rw, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// readMessage returns the next text message, of at most limit bytes,
+// answering any pings which arrive first.  It returns errWSClosed once the
+// client closes the connection.  A message must arrive within idle.
+func (c *wsConn) readMessage(limit int64, idle time.Duration) (string, error) {
+	var message []byte
+	started := false
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(idle))
+		fin, opcode, payload, err := c.readFrame(limit - int64(len(message)))
+		if err != nil {
+			return "", err
+		}
+
+		switch opcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return "", err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.close(wsNormalClosure)
+			return "", errWSClosed
+		case wsText:
+			if started {
+				c.close(wsProtocolError)
+				return "", errWSClosed
+			}
+			started = true
+		case wsContinuation:
+			if !started {
+				c.close(wsProtocolError)
+				return "", errWSClosed
+			}
+		case wsBinary:
+			c.close(wsUnsupportedData)
+			return "", errWSClosed
+		default:
+			c.close(wsProtocolError)
+			return "", errWSClosed
+		}
+
+		message = append(message, payload...)
+		if fin {
+			return string(message), nil
+		}
+	}
+}
+
+// writeFrame sends one unfragmented frame.  The server does not mask what it
+// sends.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	head := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n <= 125:
+		head = append(head, byte(n))
+	case n <= 0xFFFF:
+		head = append(head, 126, byte(n>>8), byte(n))
+	default:
+		head = append(head, 127)
+		head = binary.BigEndian.AppendUint64(head, uint64(n))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	c.rw.Write(head)
+	c.rw.Write(payload)
+	return c.rw.Flush()
+}
+
+// writeMessage sends a text message.
+func (c *wsConn) writeMessage(text string) error {
+	return c.writeFrame(wsText, []byte(text))
+}
+
+// close sends a close frame with the code and closes the connection.
+func (c *wsConn) close(code uint16) error {
+	c.writeFrame(wsClose, binary.BigEndian.AppendUint16(nil, code))
+	return c.conn.Close()
+}
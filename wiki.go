@@ -6,67 +6,196 @@
 package main
 
 import (
+	"context"
+	"embed"
 	"errors"
+	"flag"
 	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
-
-	"github.com/russross/blackfriday"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Page represents a single page in the wiki.
 type Page struct {
 	Title        string
 	Filename     string
+	ID           string // never changes, unlike the filename
+	Category     string
 	Ingredients  template.HTML
 	Instructions template.HTML
-	Index        []template.HTML
+	Prep         string // mise en place, one task per line
+	Equipment    string // the tools needed, one per line
+	Servings     string
+	Video        string // the address of a video of the recipe
+	Source       string // where the recipe came from, as a URL or a name
+	Tags         []string
+	Flags        []string // work the recipe needs, such as "needs photo"
+	Collection   template.HTML
+	ForkedFrom   string
+	MakeAgain    string // yes, no, or empty while untried
+	MadeCount    int
+	LastCooked   string // date as YYYY-MM-DD, or empty if never cooked
+	Author       string
+	LastEditedBy string
+	Scaffolds    []string
+	Notice       string // shown above the edit form
+	Pinned       bool
+	Photo        string
+	Unused       []string
+	Nutrition    *Nutrition
+
+	// The title of the recipe this one was adapted from.
+	ForkedFromTitle string
+
+	// Set when the page is shown as the recipe of the day.
+	RecipeOfTheDay bool
+
+	// The address of a player for the video, when it can be embedded.
+	VideoEmbed string
+
+	// Set when the page was too large to show whole.
+	Truncated bool
+
+	// How to show measures: "weight" shows what it can in grams, and
+	// anything else shows them as written.
+	Measure string
+
+	// How to show quantities: "fraction", "decimal", or empty to show them
+	// as written.
+	Quantities string
+
+	// Set to "serving" to show the amounts for a single serving, when the
+	// recipe says how many it serves.
+	Per string
+
+	// How to lay out the ingredients: "table" puts their amounts in a
+	// column of their own, and anything else shows them as a list.
+	Layout string
+
+	// The rows of the ingredients when they are laid out as a table.
+	IngredientRows []IngredientRow
+
+	// The markdown of the sections, kept when the page is rendered so
+	// that each can be edited in place.
+	RawIngredients  string
+	RawInstructions string
+
+	// The ingredient lines which start with a quantity, split into their
+	// parts for templates which format them themselves.
+	IngredientList []Ingredient
+
+	Theme string
+	Index Pages
 }
 
 type RootPage struct {
 	Title    string
 	Filename string
 	Body     template.HTML
-	Index    []template.HTML
+	FirstRun bool // set while the wiki has no recipes
+	Theme    string
+	Index    Pages
 }
 
-// save writes the page out to disk.
+// save writes the page out to disk.  Optional sections are only written when
+// they have something in them.  A page saved for the first time is given an
+// ID.
 func (p *Page) save() error {
-	body := fmt.Sprintf("<!-- Ingredients -->\n%s\n<!-- Instructions -->\n%s", p.Ingredients, p.Instructions)
-	return ioutil.WriteFile(filepath.Join(pagesDir, p.Filename+".txt"), []byte(body), 0600)
+	if p.ID == "" {
+		p.ID = newRecipeID()
+	}
+	body := fmt.Sprintf("<!-- Title -->\n%s\n<!-- Ingredients -->\n%s\n<!-- Instructions -->\n%s", p.Title, p.Ingredients, p.Instructions)
+
+	optional := []struct{ name, text string }{
+		{"Prep", p.Prep},
+		{"Equipment", p.Equipment},
+		{"Servings", p.Servings},
+		{"Video", p.Video},
+		{"Source", p.Source},
+		{"Tags", strings.Join(p.Tags, ", ")},
+		{"Flags", strings.Join(p.Flags, ", ")},
+		{"Collection", string(p.Collection)},
+		{"ForkedFrom", p.ForkedFrom},
+		{"MakeAgain", formatMakeAgain(p.MakeAgain, p.MadeCount)},
+		{"LastCooked", p.LastCooked},
+		{"Author", p.Author},
+		{"LastEditedBy", p.LastEditedBy},
+		{"ID", p.ID}}
+	for _, section := range optional {
+		if section.text != "" {
+			body += fmt.Sprintf("\n<!-- %s -->\n%s", section.name, section.text)
+		}
+	}
+	savesTotal.Add(1)
+	return store.Save(p.Filename, []byte(body))
 }
 
 // loadPage reads a page from disk.
 func loadPage(file string) (*Page, error) {
-	filename := filepath.Join(pagesDir, file+".txt")
-	body, err := ioutil.ReadFile(filename)
+	body, err := store.Load(file)
 	if err != nil {
 		return nil, err
 	}
 
-	ingredients, instructions := parseRecipe(body)
+	sections, err := parseRecipe(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	// Older pages have no stored title so fall back to the filename.
+	title := strings.TrimSpace(sections["Title"])
+	if title == "" {
+		title = convertFilenameToTitle(file)
+	}
+
+	category, _ := splitCategory(file)
 
 	p := &Page{
-		Title:        convertFilenameToTitle(file),
-		Filename:     filepath.Base(file),
-		Ingredients:  template.HTML(ingredients),
-		Instructions: template.HTML(instructions)}
+		Title:        title,
+		Filename:     file,
+		ID:           strings.TrimSpace(sections["ID"]),
+		Category:     category,
+		Ingredients:  template.HTML(sections["Ingredients"]),
+		Instructions: template.HTML(sections["Instructions"]),
+		Prep:         strings.TrimSpace(sections["Prep"]),
+		Equipment:    strings.TrimSpace(sections["Equipment"]),
+		Servings:     strings.TrimSpace(sections["Servings"]),
+		Video:        strings.TrimSpace(sections["Video"]),
+		Source:       strings.TrimSpace(sections["Source"]),
+		Tags:         parseTags(sections["Tags"]),
+		Flags:        parseTags(sections["Flags"]),
+		Collection:   template.HTML(sections["Collection"]),
+		ForkedFrom:   strings.TrimSpace(sections["ForkedFrom"]),
+		LastCooked:   strings.TrimSpace(sections["LastCooked"]),
+		Author:       strings.TrimSpace(sections["Author"]),
+		LastEditedBy: strings.TrimSpace(sections["LastEditedBy"])}
+	p.MakeAgain, p.MadeCount = parseMakeAgain(sections["MakeAgain"])
 
 	return p, nil
 }
 
+// loadRoot reads the home page.  A fresh wiki may have no home page yet, so
+// one which does not exist is empty rather than an error.
 func loadRoot(file string) (*RootPage, error) {
-	filename := filepath.Join(pagesDir, file+".txt")
-	body, err := ioutil.ReadFile(filename)
-	if err != nil {
+	body, err := store.Load(file)
+	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
 
@@ -74,26 +203,44 @@ func loadRoot(file string) (*RootPage, error) {
 		Title:    convertFilenameToTitle(file),
 		Filename: filepath.Base(file),
 		Body:     template.HTML(body),
-		Index:    pages}
+		FirstRun: len(pages) <= 1,
+		Index:    pages.Viewing(file)}
 
 	return p, nil
 }
 
-// rootHandler prepares the home page.
+// rootHandler prepares the home page.  Until there are any recipes it
+// welcomes the reader and helps them start.  Directives like {{recent 5}} in
+// the home page are expanded into lists of recipes.
 func rootHandler(w http.ResponseWriter, r *http.Request, title string) {
 	p, err := loadRoot(title)
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
 
-	p.Body = template.HTML(blackfriday.MarkdownCommon([]byte(p.Body)))
-	p.Body = template.HTML(convertWikiMarkup([]byte(p.Body)))
+	p.Body = template.HTML(expandDirectives(string(p.Body)))
+	renderRoot(p)
+	p.Theme = chooseTheme(w, r)
 
 	err = templates.ExecuteTemplate(w, "root.html", p)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 	}
 }
 
-// viewHandler prepares the page to be rendered by passing it through the
-// markdown and wikiMarkup filters.
+// indexHandler sends visitors to the bare host on to the home page.  Being
+// registered at "/" it also receives every path which no other handler
+// matches, and those are not found.
+func indexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		notFound(w, r)
+		return
+	}
+	http.Redirect(w, r, basePath+"/view/"+rootTitle, http.StatusFound)
+}
+
+// viewHandler renders a recipe, or the home page.
 func viewHandler(w http.ResponseWriter, r *http.Request, title string) {
 	// Special case for the root page.
 	if title == rootTitle {
@@ -101,251 +248,1103 @@ func viewHandler(w http.ResponseWriter, r *http.Request, title string) {
 		return
 	}
 
+	// The same URL gives the recipe as JSON to clients which ask for it.
+	w.Header().Add("Vary", "Accept")
+	if wantsJSON(r) {
+		apiRecipeHandler(w, r, title)
+		return
+	}
+
 	p, err := loadPage(title)
+	if os.IsNotExist(err) {
+		http.Redirect(w, r, basePath+"/edit/"+title, http.StatusFound)
+		return
+	}
 	if err != nil {
-		http.Redirect(w, r, "/edit/"+title, http.StatusFound)
+		serverError(w, r, err)
 		return
 	}
 
-	p.Ingredients = template.HTML(blackfriday.MarkdownCommon([]byte(p.Ingredients)))
-	p.Instructions = template.HTML(blackfriday.MarkdownCommon([]byte(p.Instructions)))
+	// Collections have their own view.
+	if p.Collection != "" {
+		http.Redirect(w, r, basePath+"/menu/"+title, http.StatusFound)
+		return
+	}
+
+	countView(r, p.Filename)
+	p.Truncated = truncatePage(p)
+	p.Measure = r.FormValue("measure")
+	p.Quantities = chooseQuantityStyle(r)
+	if r.FormValue("per") == "serving" {
+		p.Per = "serving"
+	}
+	if r.FormValue("layout") == "table" {
+		p.Layout = "table"
+	}
+	renderPage(p)
+	renderTemplate(w, r, "view", p)
+}
+
+// renderRoot passes the home page through the markdown and wikiMarkup filters.
+func renderRoot(p *RootPage) {
+	rendersTotal.Add(1)
+	p.Body = template.HTML(renderer.Render([]byte(p.Body)))
+	p.Body = template.HTML(convertWikiMarkup([]byte(p.Body)))
+}
+
+// renderPage prepares a recipe to be viewed by passing it through the
+// markdown and wikiMarkup filters.
+func renderPage(p *Page) {
+	rendersTotal.Add(1)
+	p.Pinned = isPinned(p.Filename)
+	p.Photo = photoURL(p.Filename)
+	p.VideoEmbed, _ = videoEmbed(p.Video)
+	p.Unused = unusedIngredients(p.Ingredients, p.Instructions)
+	p.Nutrition = estimateNutrition(p.Ingredients, p.Servings)
+	if p.ForkedFrom != "" {
+		p.ForkedFromTitle = indexTitle(p.ForkedFrom)
+	}
+	p.RawIngredients = string(p.Ingredients)
+	p.IngredientList = ingredientList(p.RawIngredients)
+	p.RawInstructions = string(p.Instructions)
+
+	if p.Measure == "weight" {
+		p.Ingredients = toWeight(p.Ingredients)
+	}
+	factor := 1.0
+	if p.Per == "serving" {
+		if servings, ok := parseServings(p.Servings); ok {
+			factor = 1 / servings
+		} else {
+			p.Per = ""
+		}
+	}
+	if p.Quantities != "" || factor != 1 {
+		p.Ingredients = restyleQuantities(p.Ingredients, factor, quantityFormatter(p.Quantities))
+	}
+	if p.Layout == "table" {
+		p.IngredientRows = ingredientRows(p.Ingredients)
+	}
+
+	p.Ingredients = template.HTML(renderer.Render([]byte(p.Ingredients)))
+	p.Instructions = template.HTML(renderer.Render([]byte(p.Instructions)))
+	p.Ingredients = template.HTML(annotateQuantities([]byte(p.Ingredients)))
+	if substitutionTips {
+		p.Ingredients = template.HTML(annotateSubstitutions([]byte(p.Ingredients)))
+	}
 	p.Ingredients = template.HTML(convertWikiMarkup([]byte(p.Ingredients)))
 	p.Instructions = template.HTML(convertWikiMarkup([]byte(p.Instructions)))
-	renderTemplate(w, "view", p)
+
+	if linkPreviews {
+		p.Ingredients = template.HTML(previewLinks([]byte(p.Ingredients)))
+		p.Instructions = template.HTML(previewLinks([]byte(p.Instructions)))
+	}
+
+	instructions, steps := numberSteps([]byte(p.Instructions))
+	p.Instructions = template.HTML(linkSteps(instructions, steps))
+	if timers {
+		p.Instructions = template.HTML(markTimers([]byte(p.Instructions)))
+	}
+	if autolink {
+		p.Instructions = template.HTML(autolinkTitles([]byte(p.Instructions), p.Title))
+	}
 }
 
-// editHandler loads an existing page from disk or creates a new empty page to
-// be rendered.
+// editHandler loads an existing page from disk or creates a new page to be
+// rendered.  A new page is empty unless the template parameter names a
+// scaffold to start from.
 func editHandler(w http.ResponseWriter, r *http.Request, title string) {
 	p, err := loadPage(title)
+	if err != nil && !os.IsNotExist(err) {
+		serverError(w, r, err)
+		return
+	}
 	if err != nil {
-		p = &Page{Title: title, Filename: title}
+		p = &Page{}
+		if name := r.FormValue("template"); name != "" {
+			if scaffold, err := loadScaffold(name); err == nil {
+				p = scaffold
+			}
+		}
+		p.Title = convertFilenameToTitle(title)
+		p.Filename = title
+		p.Category, _ = splitCategory(title)
+		p.Scaffolds = scaffoldNames()
 	}
-	renderTemplate(w, "edit", p)
+	renderTemplate(w, r, "edit", p)
 }
 
 // saveHandler saves the changes and redirects back to the page's view.
 func saveHandler(w http.ResponseWriter, r *http.Request, title string) {
 	ingredients := r.FormValue("ingredients")
 	instructions := r.FormValue("instructions")
+	prep := strings.TrimSpace(r.FormValue("prep"))
+	equipment := strings.TrimSpace(r.FormValue("equipment"))
 	recipeTitle := r.FormValue("recipeTitle")
+	servings := strings.TrimSpace(r.FormValue("servings"))
+	video := strings.TrimSpace(r.FormValue("video"))
+	source := strings.TrimSpace(r.FormValue("source"))
+	tags := parseTags(r.FormValue("tags"))
+	collection := r.FormValue("collection")
 
-	filename := convertTitleToFilename(recipeTitle)
+	category, _ := splitCategory(title)
+	if categoryDirs {
+		category = r.FormValue("category")
+	}
+
+	if r.FormValue("normalizeUnits") != "" {
+		ingredients = normalizeUnits(ingredients)
+	}
 
 	p := &Page{
 		Title:        recipeTitle,
-		Filename:     filename,
+		Category:     category,
 		Ingredients:  template.HTML(ingredients),
-		Instructions: template.HTML(instructions)}
+		Instructions: template.HTML(instructions),
+		Prep:         prep,
+		Equipment:    equipment,
+		Servings:     servings,
+		Video:        video,
+		Source:       source,
+		Tags:         tags,
+		Collection:   template.HTML(collection)}
+
+	// Keep the sections which are not on the form.
+	if old, err := loadPage(title); err == nil {
+		p.ID = old.ID
+		p.Flags = old.Flags
+		p.ForkedFrom = old.ForkedFrom
+		p.MakeAgain, p.MadeCount = old.MakeAgain, old.MadeCount
+		p.LastCooked = old.LastCooked
+		p.Author = old.Author
+	}
+	credit(p, editorName(r))
+
+	err := savePage(p, title)
+	if err == errNoTitle || err == errSectionMarker || err == errBadVideo {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == errTooManyRecipes {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, basePath+"/view/"+p.Filename, http.StatusFound)
+}
+
+// Section saves look like /save/<filename>/ingredients.  They are matched
+// before whole page saves, so a recipe in a category can't be named plain
+// lowercase "ingredients" or "instructions".
+var sectionSavePath = regexp.MustCompile("^/save/(" + filenamePattern + ")/(ingredients|instructions)$")
 
-	err := p.save()
+// saveRoute sends section saves to sectionSaveHandler and everything else to
+// saveHandler.
+func saveRoute(w http.ResponseWriter, r *http.Request) {
+	if m := sectionSavePath.FindStringSubmatch(r.URL.Path); m != nil {
+		sectionSaveHandler(w, r, m[1], m[2])
+		return
+	}
+	makeHandler(saveHandler)(w, r)
+}
+
+// sectionSaveHandler saves only the ingredients or only the instructions of
+// a recipe, leaving the rest of it as it is on disk now rather than as it
+// was when the form was loaded.
+func sectionSaveHandler(w http.ResponseWriter, r *http.Request, title, section string) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	text := r.FormValue(section)
+	if section == "ingredients" && r.FormValue("normalizeUnits") != "" {
+		text = normalizeUnits(text)
+	}
+
+	err := saveSection(title, section, text, editorName(r))
+	if os.IsNotExist(err) {
+		notFound(w, r)
+		return
+	}
+	if err == errSectionMarker {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 		return
 	}
 
-	// If the filename is different than the title then we are renaming and
-	// should remove the old file.
-	if filename != title {
-		oldfile := filepath.Join(pagesDir, title+".txt")
+	http.Redirect(w, r, basePath+"/view/"+title, http.StatusFound)
+}
+
+// updateMu keeps updates to parts of a page from interleaving, so that two
+// changing different sections of the same page at once both take effect.
+var updateMu sync.Mutex
 
-		// Only proceed with the rename if the old file exists.
-		if _, err := os.Stat(oldfile); err == nil {
-			if err := os.Remove(oldfile); err != nil {
-				panic(err)
+// updatePage reads a stored page fresh, lets change modify it and writes it
+// back whole, so the sections change leaves alone keep their current contents.
+func updatePage(filename string, change func(p *Page) error) error {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	p, err := loadPage(filename)
+	if err != nil {
+		return err
+	}
+	if err := change(p); err != nil {
+		return err
+	}
+	return p.save()
+}
+
+// saveSection replaces one section of a stored page on behalf of editor.
+func saveSection(filename, section, text, editor string) error {
+	return updatePage(filename, func(p *Page) error {
+		credit(p, editor)
+		return setSection(p, section, text)
+	})
+}
+
+// errNotReordered is returned when lines sent to reorder a section are not
+// the lines it has now.
+var errNotReordered = errors.New("The lines must be the lines of the section as it is now, in a new order.")
+
+// reorderSection rewrites one section of a stored page with its lines in a
+// new order on behalf of editor.  The lines must be exactly the lines the
+// section has now, so that nothing is lost or added.
+func reorderSection(filename, section string, lines []string, editor string) error {
+	return updatePage(filename, func(p *Page) error {
+		current, err := sectionText(p, section)
+		if err != nil {
+			return err
+		}
+
+		counts := make(map[string]int)
+		have := strings.Split(strings.TrimRight(strings.Replace(current, "\r\n", "\n", -1), "\n"), "\n")
+		for _, line := range have {
+			counts[line]++
+		}
+		for _, line := range lines {
+			counts[line]--
+		}
+		for _, n := range counts {
+			if n != 0 {
+				return errNotReordered
 			}
 		}
+		if len(lines) != len(have) {
+			return errNotReordered
+		}
+
+		credit(p, editor)
+		return setSection(p, section, strings.Join(lines, "\n")+"\n")
+	})
+}
+
+// sectionText returns the markdown of a section which can be saved alone.
+func sectionText(p *Page, section string) (string, error) {
+	switch section {
+	case "ingredients":
+		return string(p.Ingredients), nil
+	case "instructions":
+		return string(p.Instructions), nil
+	}
+	return "", fmt.Errorf("%q is not a section which can be saved alone", section)
+}
+
+// setSection replaces a section which can be saved alone.
+func setSection(p *Page, section, text string) error {
+	switch section {
+	case "ingredients":
+		p.Ingredients = template.HTML(text)
+	case "instructions":
+		p.Instructions = template.HTML(text)
+	default:
+		return fmt.Errorf("%q is not a section which can be saved alone", section)
+	}
+	if _, ok := findSectionMarker(p); ok {
+		return errSectionMarker
+	}
+	return nil
+}
+
+// errNoTitle is returned when a recipe title leaves nothing to use as a
+// filename.
+var errNoTitle = errors.New("A recipe title is required.")
+
+// maxRecipes, when above zero, is the most recipes the wiki will hold.
+var maxRecipes int
+
+// errSectionMarker is returned when a section's text has a line which would
+// be read back as the start of another section.
+var errSectionMarker = errors.New("A line like <!-- Tags --> marks a section of the stored page and cannot be part of a recipe's text.")
+
+// errTooManyRecipes is returned when saving a new recipe would go over
+// maxRecipes.
+var errTooManyRecipes = errors.New("The wiki already holds as many recipes as it is allowed.  Delete or merge one to make room.")
+
+// checkRecipeLimit returns errTooManyRecipes if saving to filename would add a
+// recipe to a wiki which is full.  Changes to an existing recipe are always
+// allowed.  The recipes are counted from the index.
+func checkRecipeLimit(filename string) error {
+	if maxRecipes <= 0 {
+		return nil
+	}
+	if filename != "" {
+		if _, err := store.Load(filename); err == nil {
+			return nil
+		}
+	}
+	if len(pages)-1 >= maxRecipes {
+		return errTooManyRecipes
+	}
+	return nil
+}
+
+// savePage stores p in place of the recipe currently stored as current, or as
+// a new recipe when current is empty, and updates the index.  The filename is
+// made from the category and title, with a suffix if another recipe already
+// uses it, and is set on p.
+func savePage(p *Page, current string) error {
+	filename := convertTitleToFilename(p.Title)
+	if filename == "" {
+		return errNoTitle
+	}
+	if _, ok := findSectionMarker(p); ok {
+		return errSectionMarker
+	}
+	if err := checkVideo(p.Video); err != nil {
+		return err
+	}
+	if err := checkRecipeLimit(current); err != nil {
+		return err
+	}
+	p.Filename = uniqueFilename(joinCategory(p.Category, filename), current)
+
+	// A recipe which keeps its title and category keeps its filename, even
+	// one made before titles were converted the way they are now, so that
+	// links to it still work.
+	if current != "" && p.Filename != current {
+		if old, err := loadPage(current); err == nil && old.Title == p.Title && old.Category == p.Category {
+			p.Filename = current
+		}
+	}
+
+	if err := p.save(); err != nil {
+		return err
 	}
 
-	updateIndex()
-	http.Redirect(w, r, "/view/"+filename, http.StatusFound)
+	// If the filename is different than the title then we are renaming and
+	// should remove the old file.
+	if current != "" && p.Filename != current {
+		// There is nothing to remove if the old file never existed.
+		if err := store.Delete(current); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	refreshIndex()
+	return nil
 }
 
+// Characters which are not allowed to appear in a filename.
+var invalidFilenameChars = regexp.MustCompile("[^-a-zA-Z0-9]+")
+var repeatedHyphens = regexp.MustCompile("-{2,}")
+
+// convertTitleToFilename turns a recipe title into a filename which will be
+// accepted by validPath.  Accents are taken off letters, spaces become
+// hyphens and any other disallowed characters are stripped.  A title of
+// letters which all get stripped, such as one in another script, is named by
+// fallbackFilename instead.
 func convertTitleToFilename(title string) string {
-	return strings.Replace(title, " ", "-", -1)
+	filename := strings.Replace(foldAccents(title), " ", "-", -1)
+	filename = invalidFilenameChars.ReplaceAllString(filename, "")
+	filename = repeatedHyphens.ReplaceAllString(filename, "-")
+	filename = strings.Trim(filename, "-")
+	if filename == "" && strings.IndexFunc(title, unicode.IsLetter) >= 0 {
+		return fallbackFilename(strings.TrimSpace(title))
+	}
+	return filename
+}
+
+// uniqueFilename returns filename, or filename with a numeric suffix like -2
+// appended if a different recipe is already stored under that name.  current
+// is the filename of the recipe being saved, which is allowed to overwrite
+// itself.
+func uniqueFilename(filename, current string) string {
+	candidate := filename
+	for n := 2; ; n++ {
+		if candidate == current {
+			return candidate
+		}
+		if _, err := store.Load(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d", filename, n)
+	}
 }
 
 func convertFilenameToTitle(filename string) string {
-	return strings.Replace(filename, "-", " ", -1)
+	_, name := splitCategory(filename)
+	return strings.Replace(name, "-", " ", -1)
 }
 
-// Parse the templates.
+// basePath is prefixed to every URL the wiki generates so that it can be
+// served from a subdirectory, such as behind a reverse proxy.  It has a leading
+// slash and no trailing slash, or is empty when serving from the root.
+var basePath string
+
+// The functions available to the templates.
+var templateFuncs = template.FuncMap{
+	"base":         func() string { return basePath },
+	"join":         strings.Join,
+	"lineItems":    lineItems,
+	"categoryDirs": func() bool { return categoryDirs },
+	"readonly":     func() bool { return readOnly },
+	"round":        func(f float64) string { return strconv.FormatFloat(f, 'f', 0, 64) },
+	"titlecase":    titleCase,
+	"pluralize":    pluralize,
+	"fraction":     formatQuantity,
+	"date":         formatDate,
+	"rootTitle":    func() string { return rootTitle },
+	"livePreview":  func() bool { return livePreview },
+	"pdfExport":    func() bool { return pdfExport },
+	"avatar":       avatarURL,
+	"flagKey":      flagKey,
+	"hasPrefix":    strings.HasPrefix}
+
+// Parse the templates.  A template in templateDir overrides the default copy
+// which is built into the binary.
 var templateDir string = "templates"
-var templateFiles []string = []string{
-	filepath.Join(templateDir, "root.html"),
-	filepath.Join(templateDir, "edit.html"),
-	filepath.Join(templateDir, "view.html")}
+var templateNames []string = []string{
+	"index.html",
+	"welcome.html",
+	"root.html",
+	"edit.html",
+	"view.html",
+	"merge.html",
+	"retag.html",
+	"autotag.html",
+	"menu.html",
+	"mealplan.html",
+	"search.html",
+	"duplicates.html",
+	"stats.html",
+	"shoppinglist.html",
+	"import.html",
+	"replace.html",
+	"queue.html",
+	"printbook.html",
+	"substitute.html",
+	"safe.html",
+	"404.html",
+	"500.html"}
 
-var templates = template.Must(template.ParseFiles(templateFiles...))
+//go:embed templates/*.html templates/recipes/*.txt
+var defaultTemplates embed.FS
+
+var templates *template.Template
+
+// parseTemplates parses each of the templates in turn so that a missing or
+// malformed file can be reported by name.
+func parseTemplates() (*template.Template, error) {
+	t := template.New("").Funcs(templateFuncs)
+	for _, name := range templateNames {
+		file := filepath.Join(templateDir, name)
+		text, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			file = "built-in " + name
+			text, err = defaultTemplates.ReadFile("templates/" + name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to load template %s: %v", file, err)
+		}
+
+		if _, err := t.New(name).Parse(string(text)); err != nil {
+			return nil, fmt.Errorf("unable to load template %s: %v", file, err)
+		}
+	}
+	return t, nil
+}
 
 // renderTemplate takes the renders the html for the given template.
-func renderTemplate(w http.ResponseWriter, tmpl string, p *Page) {
-	p.Index = pages
+func renderTemplate(w http.ResponseWriter, r *http.Request, tmpl string, p *Page) {
+	p.Index = pages.Viewing(p.Filename)
+	p.Theme = chooseTheme(w, r)
 
 	err := templates.ExecuteTemplate(w, tmpl+".html", p)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, err)
 	}
 }
 
 // Defines the set of valid URLs to expect.
-var validPath = regexp.MustCompile("^/(edit|save|view)/([-a-zA-Z0-9]+)$")
+var validPath = regexp.MustCompile("^/(edit|save|view|menu|uses|upload|api/recipe|api/scaled|api/save|fork|forks|madeitagain|cooked|raw|pdf|flag|text/ingredients)/(" + filenamePattern + ")$")
+
+// filenamePattern matches a page filename with an optional category, like
+// Apple-Pie or Desserts/Apple-Pie.
+const filenamePattern = "[-a-zA-Z0-9]+(?:/[-a-zA-Z0-9]+)?"
 
 func makeHandler(fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		m := validPath.FindStringSubmatch(r.URL.Path)
 		if m == nil {
-			http.NotFound(w, r)
+			notFound(w, r)
 			return
 		}
 		fn(w, r, m[2])
 	}
 }
 
-// a wikiLink looks like [[Words]]
-var wikiLink = regexp.MustCompile("\\[\\[([-a-zA-Z0-9 ]+)\\]\\]")
+// a wikiLink looks like [[Words]], and the words may be in any script.  The
+// page it links to is named by convertTitleToFilename.
+var wikiLink = regexp.MustCompile("\\[\\[([-\\pL\\pN ]+)\\]\\]")
 
 // convertWikiMarkup replaces wiki syntax with equivalent html.
 func convertWikiMarkup(text []byte) []byte {
-	var resultText []byte
+	return wikiLink.ReplaceAllFunc(text, func(link []byte) []byte {
+		name := string(wikiLink.FindSubmatch(link)[1])
+		target := resolveLink(convertTitleToFilename(name))
+		return []byte("<a href=\"" + basePath + "/view/" + target + "\">" + name + "</a>")
+	})
+}
 
-	matches := wikiLink.FindAllSubmatch(text, -1)
-	for _, v := range matches {
-		for _, submatch := range v[1:] {
-			targetText := regexp.MustCompile("\\[\\[(" + string(submatch) + ")\\]\\]")
-			space := regexp.MustCompile(" ")
-			linkText := space.ReplaceAll(submatch, []byte("-"))
-			replacementText := []byte("<a href=\"/view/" + string(linkText) + "\">" + string(submatch) + "</a>")
+var pagesDir string = "pages"
 
-			resultText = targetText.ReplaceAll(text, replacementText)
-		}
+// The permissions given to saved pages and to the directories created for
+// them.
+var fileMode os.FileMode = 0600
+var dirMode os.FileMode = 0700
+
+// modeValue is a flag holding an octal permission mode.  The mode must include
+// the required bits so that the wiki can still use what it creates.
+type modeValue struct {
+	mode     *os.FileMode
+	required os.FileMode
+}
+
+func (m modeValue) String() string {
+	if m.mode == nil {
+		return ""
 	}
-	return resultText
+	return fmt.Sprintf("%#o", *m.mode)
 }
 
-// Ensure the pages directory exists before the program gets going.
-var pagesDir string = "pages"
+func (m modeValue) Set(s string) error {
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return fmt.Errorf("%q is not an octal permission mode", s)
+	}
+
+	mode := os.FileMode(n)
+	if mode&^os.ModePerm != 0 {
+		return fmt.Errorf("%#o is not a permission mode", n)
+	}
+	if mode&m.required != m.required {
+		return fmt.Errorf("%#o must include at least %#o", n, m.required)
+	}
 
-func init() {
+	*m.mode = mode
+	return nil
+}
+
+// createPagesDir ensures the pages directory exists before the program gets
+// going.
+func createPagesDir() error {
 	if _, err := os.Stat(pagesDir); os.IsNotExist(err) {
-		if err := os.Mkdir(pagesDir, 0700); err != nil {
-			panic(err)
-		}
+		return os.Mkdir(pagesDir, dirMode)
+	}
+	return nil
+}
+
+// IndexEntry is a single page listed in the wiki index.
+type IndexEntry struct {
+	Title    string
+	Filename string
+	Route    string
+	ID       string
+	Pin      int  // position among the pinned entries, or 0 if not pinned
+	Current  bool // set for the page being shown
+}
+
+// IndexGroup holds the index entries whose titles start with Letter.
+type IndexGroup struct {
+	Letter  string
+	Entries []IndexEntry
+}
+
+// Anchor returns the id of the group's heading so the jump bar can link to it.
+func (g IndexGroup) Anchor() string {
+	if g.Letter == "#" {
+		return "index-other"
 	}
+	return "index-" + g.Letter
 }
 
 // get a list of all of the pages
-type Pages []template.HTML
+type Pages []IndexEntry
 
 func (p Pages) Len() int {
 	return len(p)
 }
 
 func (p Pages) Less(i, j int) bool {
-	if p[i] == "Home" {
+	if p[i].Filename == rootTitle {
 		return true
-	} else if p[j] == "Home" {
+	} else if p[j].Filename == rootTitle {
 		return false
 	}
-	return p[i] < p[j]
+
+	// Pinned entries follow Home in their pinned order.
+	if p[i].Pin != 0 || p[j].Pin != 0 {
+		if p[i].Pin == 0 || p[j].Pin == 0 {
+			return p[i].Pin != 0
+		}
+		return p[i].Pin < p[j].Pin
+	}
+
+	return strings.ToLower(p[i].Title) < strings.ToLower(p[j].Title)
 }
 
 func (p Pages) Swap(i, j int) {
 	p[i], p[j] = p[j], p[i]
 }
 
+// Home returns the entry for the root page, which is always first.
+func (p Pages) Home() IndexEntry {
+	return p[0]
+}
+
+// Viewing returns a copy of the index with the entry for filename marked as
+// the current one, so the template can highlight where the reader is.
+func (p Pages) Viewing(filename string) Pages {
+	viewing := make(Pages, len(p))
+	copy(viewing, p)
+	for i := range viewing {
+		viewing[i].Current = viewing[i].Filename == filename
+	}
+	return viewing
+}
+
+// Pinned returns the pinned entries in their pinned order.
+func (p Pages) Pinned() []IndexEntry {
+	var pinned []IndexEntry
+	for _, entry := range p[1:] {
+		if entry.Pin != 0 {
+			pinned = append(pinned, entry)
+		}
+	}
+	return pinned
+}
+
+// Groups returns every entry but Home and the pinned entries grouped under the
+// first letter of its title.  Titles which do not start with a letter are
+// grouped under "#".
+func (p Pages) Groups() []IndexGroup {
+	var groups []IndexGroup
+
+	for _, entry := range p[1:] {
+		if entry.Pin != 0 {
+			continue
+		}
+
+		letter := "#"
+		if r, _ := utf8.DecodeRuneInString(entry.Title); unicode.IsLetter(r) {
+			letter = string(unicode.ToUpper(r))
+		}
+
+		if len(groups) == 0 || groups[len(groups)-1].Letter != letter {
+			groups = append(groups, IndexGroup{Letter: letter})
+		}
+		last := &groups[len(groups)-1]
+		last.Entries = append(last.Entries, entry)
+	}
+
+	return groups
+}
+
 var pages Pages
 
-// Get an initial list of all of the pages.
-func init() {
-	updateIndex()
+// refreshIndex updates the index after a page has changed.  A failure is only
+// logged, leaving the previous index in place.
+func refreshIndex() {
+	if err := updateIndex(); err != nil {
+		log.Printf("unable to update the index: %v", err)
+	}
 }
 
-// updateIndex reads the list of files in pages/ and creates a sorted index.
+// updateIndex reads the list of pages in the store and creates a sorted index.
 // The Home page sorts ahead of all others.
-func updateIndex() {
-	dirs, err := ioutil.ReadDir(pagesDir)
+func updateIndex() error {
+	names, err := store.List()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	var urls Pages = make([]template.HTML, 0)
+	var pinned []string
+	err = withMeta(func() (err error) {
+		pinned, err = loadPinned()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	pinOrder := make(map[string]int)
+	for i, name := range pinned {
+		pinOrder[name] = i + 1
+	}
 
-	for _, v := range dirs {
-		if !strings.HasPrefix(v.Name(), ".") {
-			name := strings.Replace(v.Name(), ".txt", "", -1)
-			if name == rootTitle {
-				continue
-			}
+	index := Pages{IndexEntry{Title: rootTitle, Filename: rootTitle, Route: "view"}}
 
-			title := convertFilenameToTitle(name)
-			url := fmt.Sprintf("<a href=\"/view/%s\">%s</a>", name, title)
-			urls = append(urls, template.HTML(url))
+	for _, name := range names {
+		if name == rootTitle {
+			continue
 		}
+
+		entry := IndexEntry{
+			Title:    convertFilenameToTitle(name),
+			Filename: name,
+			Route:    "view",
+			Pin:      pinOrder[name]}
+		if p, err := loadPage(name); err == nil {
+			entry.Title = p.Title
+			entry.ID = p.ID
+
+			// Collections link straight to their menu view.
+			if p.Collection != "" {
+				entry.Route = "menu"
+			}
+		}
+		index = append(index, entry)
 	}
-	sort.Sort(urls)
+	sort.Sort(index)
 
-	home := template.HTML(fmt.Sprintf(`<a href="/view/%s">%s</a>`, rootTitle, rootTitle))
+	pages = index
+	if autolink {
+		autolinks = buildAutolinks(index)
+	}
+	return nil
+}
+
+// The sections a page may be divided into.  Each one starts with a marker
+// line like <!-- Ingredients -->.
+var sectionNames = []string{"Title", "Ingredients", "Instructions", "Prep", "Equipment", "Servings", "Video", "Source", "Tags", "Flags", "Collection", "ForkedFrom", "MakeAgain", "LastCooked", "Author", "LastEditedBy", "ID"}
+
+// sectionMarker reports which section, if any, the line starts.
+func sectionMarker(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	for _, name := range sectionNames {
+		if line == "<!-- "+name+" -->" {
+			return name, true
+		}
+	}
+	return "", false
+}
 
-	pages = make([]template.HTML, 1)
-	pages[0] = home
-	pages = append(pages, urls...)
+// parseRecipe separates the loaded page into its sections, keyed by name.
+// Sections which do not appear in the page are missing from the map.  A page
+// may start with YAML frontmatter when frontmatter is set.
+func parseRecipe(content []byte) (map[string]string, error) {
+	if frontmatter {
+		if meta, rest, ok := splitFrontmatter(string(content)); ok {
+			return parseFrontmatterRecipe(meta, rest)
+		}
+	}
+	return parseSections(content)
 }
 
-// parseRecipe separates the loaded page into ingredients and instructions.
-func parseRecipe(content []byte) (ingredients, instructions template.HTML) {
+// parseSections separates a page marked into sections.  Lines which hold
+// only an html comment, or which are part of a comment spanning several
+// lines, are dropped.  Blank lines are kept within a section and ignored
+// before the first one.  Any other text before the first section marker makes
+// the page malformed.
+func parseSections(content []byte) (map[string]string, error) {
 	lines := strings.Split(string(content), "\n")
 
-	inIngredients := false
-	inInstructions := false
-
-	for _, line := range lines {
-		switch line {
-		case "<!-- Ingredients -->":
-			inIngredients = true
-			inInstructions = false
-		case "<!-- Instructions -->":
-			inIngredients = false
-			inInstructions = true
-		default:
-			if inIngredients {
-				ingredients += template.HTML(line + "\n")
-			} else if inInstructions {
-				instructions += template.HTML(line + "\n")
-			} else {
-				panic(errors.New("Found bad line!  " + line))
+	sections := make(map[string]string)
+	current := ""
+	var body []string
+	inComment := false
+
+	for n, line := range lines {
+		// A section marker always ends a comment left open before it, so
+		// that an unclosed <!-- can't hide the sections after it.
+		if name, ok := sectionMarker(line); ok {
+			if current != "" {
+				sections[current] = strings.Join(body, "\n")
 			}
+			current = name
+			body = nil
+			inComment = false
+			continue
 		}
+
+		if inComment {
+			inComment = !strings.Contains(line, "-->")
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "<!--") {
+			end := strings.Index(trimmed, "-->")
+			if end < 0 {
+				inComment = true
+				continue
+			}
+			if end+len("-->") == len(trimmed) {
+				continue
+			}
+		}
+
+		if current == "" {
+			if trimmed == "" {
+				continue
+			}
+			return nil, fmt.Errorf("line %d is outside of any section: %q", n+1, line)
+		}
+		body = append(body, line)
+	}
+
+	if current != "" {
+		sections[current] = strings.Join(body, "\n")
 	}
 
-	return
+	return sections, nil
 }
 
 var rootTitle string = "Home"
 
+// envOr returns the value of the environment variable name, or def when it is
+// unset or empty.
+func envOr(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// The longest time to let requests in progress finish when the wiki is asked
+// to stop.
+var shutdownTimeout = 10 * time.Second
+
 func main() {
-	var server = "localhost:8080"
+	// Settings which a container is likely to change can also be made with
+	// environment variables.  A flag overrides its variable and the variable
+	// overrides the built-in default, because the variable only replaces the
+	// default the flag starts with.
+	var server string
+	flag.StringVar(&server, "addr", envOr("RECIPE_ADDR", "localhost:8080"), "address to serve the wiki on (default $RECIPE_ADDR or localhost:8080)")
+	apiServer := flag.String("api-addr", os.Getenv("RECIPE_API_ADDR"), "address to also serve only the read-only JSON API on (default $RECIPE_API_ADDR)")
+	flag.StringVar(&pagesDir, "pages", envOr("RECIPE_PAGES_DIR", pagesDir), "directory the pages are kept in (default $RECIPE_PAGES_DIR or pages)")
+
+	// Timeouts which stop slow or idle clients from holding connections open.
+	var readTimeout, writeTimeout, idleTimeout time.Duration
+	flag.DurationVar(&readTimeout, "read-timeout", 10*time.Second, "longest time to read a request")
+	flag.DurationVar(&writeTimeout, "write-timeout", 30*time.Second, "longest time to write a response")
+	flag.DurationVar(&idleTimeout, "idle-timeout", 2*time.Minute, "longest time to keep an idle connection open")
+
+	flag.StringVar(&templateDir, "templates", templateDir, "directory of templates which override the built-in ones")
+	flag.Var(modeValue{&fileMode, 0600}, "file-mode", "permissions of saved pages, in octal")
+	flag.Var(modeValue{&dirMode, 0700}, "dir-mode", "permissions of created directories, in octal")
+	flag.Int64Var(&maxUploadSize, "max-upload", maxUploadSize, "largest photo upload allowed, in bytes")
+	flag.StringVar(&basePath, "base-path", os.Getenv("RECIPE_BASE_PATH"), "path prefix the wiki is served under, such as /recipes (default $RECIPE_BASE_PATH)")
+	flag.StringVar(&apiKey, "api-key", os.Getenv("RECIPE_WIKI_API_KEY"), "key required in the X-API-Key header to write through the API (default $RECIPE_WIKI_API_KEY)")
+	flag.StringVar(&pageExt, "ext", pageExt, "file extension of stored pages, such as .md")
+	flag.BoolVar(&linkPreviews, "link-previews", false, "show bare links to other sites with the title of the page, fetched by the server")
+	flag.BoolVar(&timers, "timers", false, "mark durations in instructions so they can be timed")
+	flag.BoolVar(&autolink, "autolink", false, "link recipe titles mentioned in instructions")
+	flag.BoolVar(&frontmatter, "frontmatter", true, "read the YAML frontmatter at the start of pages written by Markdown tools")
+	flag.BoolVar(&livePreview, "live-preview", false, "render the recipe beside the edit form as it is typed, over a WebSocket")
+	flag.BoolVar(&substitutionTips, "substitution-tips", false, "show substitutions for ingredients as tooltips in the view")
+	flag.Func("canonical-host", "host name, with any port, to redirect requests for any other host to", setCanonicalHost)
+	flag.Func("quantities", "how to show ingredient quantities: fraction or decimal (default as written)", setQuantityStyle)
+	flag.Func("date-format", "how to show dates: iso, us, eu, long, text or a Go time layout (default iso)", setDateFormat)
+	flag.Func("cors-origins", "comma separated origins, or *, allowed to call the API from a browser", setCORSOrigins)
+	flag.IntVar(&maxRenderSize, "max-render-size", maxRenderSize, "most bytes of a recipe to render in a view, or 0 for no limit")
+	flag.IntVar(&maxRecipes, "max-recipes", 0, "most recipes the wiki may hold, or 0 for no limit")
+	flag.StringVar(&defaultAuthor, "author", "", "name to credit with changes when the editor is not known from trusted basic auth")
+	flag.BoolVar(&trustBasicAuth, "trust-basic-auth", false, "credit changes to the user name of basic auth; only safe behind a proxy which checks the password")
+	authorEmailsFile := flag.String("author-emails", "", "CSV file of author names and email addresses, to show their gravatars")
+	flag.BoolVar(&readOnly, "readonly", false, "serve the wiki without any way to change it, such as for a kiosk")
+	flag.BoolVar(&categoryDirs, "category-dirs", false, "store recipes in a subdirectory for their category")
+	browserCommand := flag.String("browser", "", "command, with any arguments, to open the wiki with instead of the default browser")
+	noBrowser := flag.Bool("no-browser", false, "do not open a browser when the wiki starts")
+	storeKind := flag.String("store", "file", "where pages are kept: file, for a file per page, or sqlite")
+	dbFile := flag.String("db", "", "database file of the sqlite store (default wiki.db in the pages directory)")
+	logFormat := flag.String("log-format", "text", "format of the log, text or json")
+	paprikaFile := flag.String("import-paprika", "", "import the recipes in this Paprika export and exit")
+	check := flag.Bool("check", false, "report any malformed pages and exit, with status 1 if there were some")
+	exportDir := flag.String("export-static", "", "render every page as html into this directory and exit")
+	flag.Parse()
+
+	if err := setupLogging(*logFormat); err != nil {
+		log.Fatal(err)
+	}
+
+	if !strings.HasPrefix(pageExt, ".") {
+		pageExt = "." + pageExt
+	}
+	if pageExt == "." || strings.ContainsAny(pageExt, `/\`) {
+		log.Fatalf("-ext %q is not a file extension", pageExt)
+	}
+
+	basePath = strings.TrimRight(basePath, "/")
+	if basePath != "" && !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+
+	// Get the pages directory and an initial list of all of the pages.
+	if err := createPagesDir(); err != nil {
+		log.Fatal(err)
+	}
+	switch *storeKind {
+	case "file":
+		store = fileStore{dir: pagesDir}
+	case "sqlite":
+		if *dbFile == "" {
+			*dbFile = filepath.Join(pagesDir, "wiki.db")
+		}
+		s, err := openSQLiteStore(*dbFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		store = s
+	default:
+		log.Fatalf("-store %q is not file or sqlite", *storeKind)
+	}
+	if *check {
+		bad, err := checkPages(os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if bad > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *paprikaFile != "" {
+		data, err := ioutil.ReadFile(*paprikaFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := importPaprika(data, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *authorEmailsFile != "" {
+		if err := loadAuthorEmails(*authorEmailsFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := updateIndex(); err != nil {
+		log.Fatal(err)
+	}
+
+	var err error
+	templates, err = parseTemplates()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *exportDir != "" {
+		if err := exportStatic(*exportDir); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	// open the default browser to the view/Home endpoint.
+	if err := withMeta(loadViews); err != nil {
+		log.Fatal(err)
+	}
+	go flushViews()
+
+	// open the browser to the view/Home endpoint.  The -browser command is
+	// given the URL as its last argument.
 	var browser *exec.Cmd
-	var url string = "http://" + server + "/view/" + rootTitle
+	var url string = "http://" + server + basePath + "/view/" + rootTitle
 
-	switch runtime.GOOS {
-	case "windows":
+	switch {
+	case *noBrowser:
+	case strings.TrimSpace(*browserCommand) != "":
+		args := strings.Fields(*browserCommand)
+		browser = exec.Command(args[0], append(args[1:], url)...)
+	case runtime.GOOS == "windows":
 		browser = exec.Command(`C:\Windows\System32\rundll32.exe`, "url.dll,FileProtocolHandler", url)
-	case "darwin":
+	case runtime.GOOS == "darwin":
 		browser = exec.Command("open", url)
 	default:
 		browser = exec.Command("xdg-open", url)
 	}
-	if err := browser.Start(); err != nil {
-		panic(err)
+	if browser != nil {
+		if err := browser.Start(); err != nil {
+			log.Printf("could not open a browser: %v", err)
+		}
+	}
+
+	// Start the server, and the API server when it has an address of its
+	// own.  The canonical host is only for the wiki's own pages.
+	newServer := func(addr string, handler http.Handler) *http.Server {
+		return &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadHeaderTimeout: readTimeout,
+			ReadTimeout:       readTimeout,
+			WriteTimeout:      writeTimeout,
+			IdleTimeout:       idleTimeout}
+	}
+	servers := []*http.Server{newServer(server, redirectToCanonicalHost(serveMux(newMux(allRoutes))))}
+	if *apiServer != "" {
+		servers = append(servers, newServer(*apiServer, serveMux(newMux(readAPIRoutes))))
 	}
 
-	// register the handlers and start the server.
-	http.HandleFunc("/view/", makeHandler(viewHandler))
-	http.HandleFunc("/edit/", makeHandler(editHandler))
-	http.HandleFunc("/save/", makeHandler(saveHandler))
-	http.Handle("/resources/", http.StripPrefix("/resources/", http.FileServer(http.Dir("resources"))))
-	http.ListenAndServe(server, nil)
+	// Stop cleanly when asked to, as a container is by SIGTERM: finish the
+	// requests in progress and write out what is only kept in memory.
+	stopped := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+		sig := <-signals
+		log.Printf("received %v, shutting down", sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		for _, srv := range servers {
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Printf("shutdown: %v", err)
+			}
+		}
+		close(stopped)
+	}()
+
+	for _, srv := range servers[1:] {
+		go func(srv *http.Server) {
+			if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}(srv)
+	}
+	if err := servers[0].ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
+
+	if err := withMeta(saveViews); err != nil {
+		log.Printf("unable to save the view counts: %v", err)
+	}
+	if c, ok := store.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Printf("closing the store: %v", err)
+		}
+	}
 }
@@ -0,0 +1,209 @@
+// Copyright 2014 Quincy Bowers.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// useMemStore points the wiki at an empty memStore for the length of a test,
+// with a scratch pages directory for the files kept beside the pages.
+func useMemStore(t *testing.T) *memStore {
+	t.Helper()
+	s := newMemStore()
+	oldStore, oldDir := store, pagesDir
+	store, pagesDir = s, t.TempDir()
+	t.Cleanup(func() {
+		store, pagesDir = oldStore, oldDir
+		refreshIndex()
+	})
+
+	if templates == nil {
+		var err error
+		if templates, err = parseTemplates(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	refreshIndex()
+	return s
+}
+
+// serve sends a request through the handler and returns the response.
+func serve(h http.HandlerFunc, method, target string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	if form != nil {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+const applePie = "<!-- Title -->\nApple Pie\n<!-- Ingredients -->\n- 6 apples\n<!-- Instructions -->\nBake.\n"
+
+func TestViewHandler(t *testing.T) {
+	s := useMemStore(t)
+	s.Save("Apple-Pie", []byte(applePie))
+	refreshIndex()
+
+	w := serve(makeHandler(viewHandler), "GET", "/view/Apple-Pie", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "Apple Pie") || !strings.Contains(body, "6 apples") {
+		t.Errorf("the view is missing the recipe:\n%s", body)
+	}
+
+	// A recipe which does not exist yet is offered to be written.
+	w = serve(makeHandler(viewHandler), "GET", "/view/Cherry-Pie", nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/edit/Cherry-Pie" {
+		t.Errorf("got %d to %q, want 302 to /edit/Cherry-Pie", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestSaveHandler(t *testing.T) {
+	s := useMemStore(t)
+
+	w := serve(makeHandler(saveHandler), "POST", "/save/New-Recipe", url.Values{
+		"recipeTitle":  {"Apple Pie"},
+		"ingredients":  {"- 6 apples"},
+		"instructions": {"Bake."}})
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/view/Apple-Pie" {
+		t.Fatalf("got %d to %q, want 302 to /view/Apple-Pie", w.Code, w.Header().Get("Location"))
+	}
+	body, err := s.Load("Apple-Pie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "<!-- Ingredients -->\n- 6 apples") {
+		t.Errorf("saved page:\n%s", body)
+	}
+
+	w = serve(makeHandler(saveHandler), "POST", "/save/New-Recipe", url.Values{"recipeTitle": {"!!!"}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status of a save without a title = %d, want 400", w.Code)
+	}
+}
+
+func TestSaveHandlerUnclosedComment(t *testing.T) {
+	s := useMemStore(t)
+
+	w := serve(makeHandler(saveHandler), "POST", "/save/Boiled-Egg", url.Values{
+		"recipeTitle":  {"Boiled Egg"},
+		"ingredients":  {"- 1 egg\n<!-- TODO: check"},
+		"instructions": {"Boil."}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status of a save with an unclosed comment = %d, want 400", w.Code)
+	}
+	if names, _ := s.List(); len(names) != 0 {
+		t.Errorf("pages after the refused save = %v, want none", names)
+	}
+}
+
+func TestSaveHandlerRename(t *testing.T) {
+	s := useMemStore(t)
+	s.Save("Apple-Pie", []byte(applePie))
+	refreshIndex()
+
+	w := serve(makeHandler(saveHandler), "POST", "/save/Apple-Pie", url.Values{
+		"recipeTitle":  {"Apple Tart"},
+		"ingredients":  {"- 6 apples"},
+		"instructions": {"Bake."}})
+	if w.Header().Get("Location") != "/view/Apple-Tart" {
+		t.Fatalf("redirected to %q, want /view/Apple-Tart", w.Header().Get("Location"))
+	}
+	if names, _ := s.List(); len(names) != 1 || names[0] != "Apple-Tart" {
+		t.Errorf("pages after the rename = %v, want [Apple-Tart]", names)
+	}
+	p, err := loadPage("Apple-Tart")
+	if err != nil || p.ID == "" {
+		t.Errorf("the renamed page lost its ID: %v %v", p, err)
+	}
+}
+
+func TestParseSections(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name:    "plain",
+			content: "<!-- Title -->\nApple Pie\n<!-- Ingredients -->\n- 6 apples",
+			want:    map[string]string{"Title": "Apple Pie", "Ingredients": "- 6 apples"},
+		},
+		{
+			name:    "blank lines before the first marker",
+			content: "\n\n  \n<!-- Title -->\nApple Pie",
+			want:    map[string]string{"Title": "Apple Pie"},
+		},
+		{
+			name:    "leading comment",
+			content: "<!-- written by hand -->\n<!-- Title -->\nApple Pie",
+			want:    map[string]string{"Title": "Apple Pie"},
+		},
+		{
+			name:    "leading comment over several lines",
+			content: "<!--\nnotes for later\n-->\n\n<!-- Title -->\nApple Pie",
+			want:    map[string]string{"Title": "Apple Pie"},
+		},
+		{
+			name:    "comment within a section",
+			content: "<!-- Title -->\nApple Pie\n<!-- Ingredients -->\n- 6 apples\n<!-- more next year -->\n- sugar",
+			want:    map[string]string{"Title": "Apple Pie", "Ingredients": "- 6 apples\n- sugar"},
+		},
+		{
+			name:    "blank lines within a section",
+			content: "<!-- Title -->\nApple Pie\n<!-- Instructions -->\nPeel.\n\nBake.\n",
+			want:    map[string]string{"Title": "Apple Pie", "Instructions": "Peel.\n\nBake.\n"},
+		},
+		{
+			name:    "text after a comment on the same line",
+			content: "<!-- Title -->\nApple Pie\n<!-- Instructions -->\n<!-- note --> Bake.",
+			want:    map[string]string{"Title": "Apple Pie", "Instructions": "<!-- note --> Bake."},
+		},
+		{
+			name:    "unclosed comment ended by the next marker",
+			content: "<!-- Title -->\nApple Pie\n<!-- Ingredients -->\n- 1 egg\n<!-- TODO: check\n<!-- Instructions -->\nBoil.",
+			want:    map[string]string{"Title": "Apple Pie", "Ingredients": "- 1 egg", "Instructions": "Boil."},
+		},
+		{
+			name:    "empty section",
+			content: "<!-- Title -->\nApple Pie\n<!-- Tags -->\n<!-- ID -->\nabc",
+			want:    map[string]string{"Title": "Apple Pie", "Tags": "", "ID": "abc"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseSections([]byte(tt.content))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+			continue
+		}
+		for name, text := range tt.want {
+			if got[name] != text {
+				t.Errorf("%s: section %s = %q, want %q", tt.name, name, got[name], text)
+			}
+		}
+	}
+}
+
+func TestParseSectionsMalformed(t *testing.T) {
+	for _, content := range []string{
+		"Apple Pie\n<!-- Title -->\nApple Pie",
+		"<!-- a comment -->\nstray text\n<!-- Title -->\nApple Pie",
+	} {
+		if _, err := parseSections([]byte(content)); err == nil {
+			t.Errorf("parseSections(%q) did not report the text outside any section", content)
+		}
+	}
+}